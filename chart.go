@@ -0,0 +1,183 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+	"k8s.io/helm/pkg/chartutil"
+	"k8s.io/helm/pkg/hooks"
+	"k8s.io/helm/pkg/proto/hapi/chart"
+	"k8s.io/helm/pkg/renderutil"
+)
+
+// chartManifest is a rendered chart template
+type chartManifest struct {
+	Name    string
+	Content string
+}
+
+// renderChart renders a helm chart directory with the helm built-in objects
+// (.Release, .Chart, .Capabilities, .Files) and any override values
+func renderChart(c *cli.Context, dir string) ([]chartManifest, error) {
+	chrt, err := chartutil.Load(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error loading chart '%s':%s", dir, err)
+	}
+	values, err := chartValues(c)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := yaml.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	// Helm installs to the default namespace unless one is set
+	namespace := c.String("namespace")
+	if namespace == "" {
+		namespace = "default"
+	}
+	name := c.String(FlagReleaseName)
+	if name == "" {
+		name = chrt.Metadata.Name
+	}
+	rendered, err := renderutil.Render(chrt, &chart.Config{Raw: string(raw)}, renderutil.Options{
+		ReleaseOptions: chartutil.ReleaseOptions{
+			Name:      name,
+			Namespace: namespace,
+			IsInstall: true,
+			Revision:  1,
+		},
+		KubeVersion: c.String(FlagKubeVersion),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error rendering chart '%s':%s", dir, err)
+	}
+	return chartManifests(rendered)
+}
+
+// chartValues merges the chart values files and any --set overrides
+func chartValues(c *cli.Context) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	for _, f := range c.StringSlice(FlagChartValues) {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parseConfigData(f, data)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing chart values file '%s':%s", f, err)
+		}
+		src, _ := toStringMap(parsed)
+		values = mergeValues(values, src, ListMergeReplace)
+	}
+	if err := setValues(c, values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// chartInstallOrder is the order helm installs kinds in, from helm's
+// tiller.InstallOrder (the tiller package pulls in the kubernetes client)
+var chartInstallOrder = []string{
+	"Namespace",
+	"ResourceQuota",
+	"LimitRange",
+	"PodSecurityPolicy",
+	"PodDisruptionBudget",
+	"Secret",
+	"ConfigMap",
+	"StorageClass",
+	"PersistentVolume",
+	"PersistentVolumeClaim",
+	"ServiceAccount",
+	"CustomResourceDefinition",
+	"ClusterRole",
+	"ClusterRoleBinding",
+	"Role",
+	"RoleBinding",
+	"Service",
+	"DaemonSet",
+	"Pod",
+	"ReplicationController",
+	"ReplicaSet",
+	"Deployment",
+	"StatefulSet",
+	"Job",
+	"CronJob",
+	"Ingress",
+	"APIService",
+}
+
+// chartDoc is the part of a rendered chart document used to order and filter it
+type chartDoc struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Annotations map[string]string `yaml:"annotations"`
+	} `yaml:"metadata"`
+}
+
+// chartManifests splits the rendered templates into documents in helm's
+// install order (by kind then template name), leaving out notes, partials,
+// templates which render to nothing, hooks and tests
+func chartManifests(rendered map[string]string) ([]chartManifest, error) {
+	names := make([]string, 0, len(rendered))
+	for name := range rendered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var manifests []chartManifest
+	var kinds []string
+	for _, name := range names {
+		base := path.Base(name)
+		if base == "NOTES.txt" || strings.HasPrefix(base, "_") {
+			continue
+		}
+		if strings.Contains(name, "/templates/tests/") {
+			logInfo.Printf("skipping chart test %s", name)
+			continue
+		}
+		for _, content := range splitYamlDocs(rendered[name]) {
+			var doc chartDoc
+			if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+				return nil, fmt.Errorf("error parsing chart template '%s':%s", name, err)
+			}
+			if hook, ok := doc.Metadata.Annotations[hooks.HookAnno]; ok {
+				logInfo.Printf("skipping %s hook %s in %s, hooks are not supported", hook, strings.ToLower(doc.Kind), name)
+				continue
+			}
+			manifests = append(manifests, chartManifest{Name: name, Content: content})
+			kinds = append(kinds, doc.Kind)
+		}
+	}
+	order := make([]int, len(manifests))
+	for i := range manifests {
+		order[i] = i
+	}
+	// Kinds helm doesn't know are installed last, ordered by kind
+	rank := func(i int) (int, string) {
+		for n, kind := range chartInstallOrder {
+			if kinds[i] == kind {
+				return n, ""
+			}
+		}
+		return len(chartInstallOrder), kinds[i]
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		ri, ki := rank(order[i])
+		rj, kj := rank(order[j])
+		if ri != rj {
+			return ri < rj
+		}
+		return ki < kj
+	})
+	sorted := make([]chartManifest, len(order))
+	for i, n := range order {
+		sorted[i] = manifests[n]
+	}
+	return sorted, nil
+}
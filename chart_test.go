@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestRenderChart(t *testing.T) {
+	flags := []cli.Flag{
+		cli.StringFlag{Name: "namespace"},
+		cli.StringFlag{Name: FlagReleaseName},
+		cli.StringFlag{Name: FlagKubeVersion},
+		cli.StringSliceFlag{Name: FlagChartValues},
+		cli.StringSliceFlag{Name: FlagSet},
+		cli.StringSliceFlag{Name: FlagSetString},
+		cli.StringSliceFlag{Name: FlagSetFile},
+	}
+	cases := []struct {
+		name     string
+		args     []string
+		want     []string
+		contains []string
+	}{
+		{
+			name: "Renders with the chart values and built-in objects",
+			args: []string{"--namespace", "dev"},
+			want: []string{"app/templates/serviceaccount.yaml", "app/templates/deployment.yaml"},
+			contains: []string{
+				"name: app-app",
+				"namespace: dev",
+				`image: "app:latest"`,
+			},
+		},
+		{
+			name:     "Renders to the default namespace",
+			want:     []string{"app/templates/serviceaccount.yaml", "app/templates/deployment.yaml"},
+			contains: []string{"namespace: default"},
+		},
+		{
+			name: "Renders with override values",
+			args: []string{
+				"--release-name", "prod",
+				"--kube-version", "1.12",
+				"--chart-values", "test/TestChart/values-prod.yaml",
+				"--set", "replicas=3",
+			},
+			want: []string{"app/templates/configmap.yaml", "app/templates/serviceaccount.yaml", "app/templates/deployment.yaml"},
+			contains: []string{
+				"name: prod-app",
+				`kube: "1.12"`,
+				"replicas: 3",
+				`image: "app:v1.2.3"`,
+				`config: "prod"`,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := newTestContext(flags, c.args)
+			manifests, err := renderChart(ctx, "test/TestChart/app")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			var all string
+			for _, m := range manifests {
+				got = append(got, m.Name)
+				all += m.Content
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+			for _, s := range c.contains {
+				if !strings.Contains(all, s) {
+					t.Errorf("expected %q in:\n%s", s, all)
+				}
+			}
+			// Hooks and tests aren't deployed
+			for _, s := range []string{"app-migrate", "app-test"} {
+				if strings.Contains(all, s) {
+					t.Errorf("unexpected %q in:\n%s", s, all)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+	"k8s.io/helm/pkg/strvals"
+)
+
+const (
+	// ListMergeReplace replaces a list from earlier config data with a later one
+	ListMergeReplace = "replace"
+	// ListMergeAppend appends a list from later config data to an earlier one
+	ListMergeAppend = "append"
+)
+
+// EnvToData creates a map of all environment variables for use as config
+// data, optionally with values converted to booleans, integers or JSON
+func EnvToData(typed bool) map[string]interface{} {
+	m := map[string]interface{}{}
+	for k, v := range EnvToMap() {
+		if typed {
+			m[k] = typedEnvValue(v)
+		} else {
+			m[k] = v
+		}
+	}
+	return m
+}
+
+// typedEnvValue converts an environment variable value to an integer, boolean
+// or JSON object / array if it parses as one. Floats are left as strings as
+// they are usually versions e.g. 1.10
+func typedEnvValue(v string) interface{} {
+	trimmed := strings.TrimSpace(v)
+	// Only integers which round trip, zero padded values are usually ids
+	if i, err := strconv.ParseInt(trimmed, 10, 64); err == nil && strconv.FormatInt(i, 10) == trimmed {
+		return i
+	}
+	switch strings.ToLower(trimmed) {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		if conf, err := decodeJSON([]byte(trimmed)); err == nil {
+			return conf
+		}
+	}
+	return v
+}
+
+// parseConfigData parses config data according to the file extension;
+// .json, .toml, .env or yaml for anything else
+func parseConfigData(f string, data []byte) (interface{}, error) {
+	switch strings.ToLower(filepath.Ext(f)) {
+	case ".json":
+		return decodeJSON(data)
+	case ".toml":
+		conf := make(map[string]interface{})
+		if err := toml.Unmarshal(data, &conf); err != nil {
+			return nil, err
+		}
+		return normalizeValue(conf), nil
+	case ".env":
+		// Loaded into the config data only, not the process environment
+		env, err := godotenv.Unmarshal(string(data))
+		if err != nil {
+			return nil, err
+		}
+		conf := make(map[string]interface{}, len(env))
+		for k, v := range env {
+			conf[k] = v
+		}
+		return conf, nil
+	}
+	var conf interface{}
+	if err := yaml.Unmarshal(data, &conf); err != nil {
+		return nil, err
+	}
+	return conf, nil
+}
+
+// decodeJSON decodes JSON keeping integers as integers
+func decodeJSON(data []byte) (interface{}, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+	return normalizeValue(v), nil
+}
+
+// mergeValues deep merges src into dst, values in src take precedence. Maps
+// are merged recursively and lists are replaced or appended to by policy.
+func mergeValues(dst, src map[string]interface{}, listPolicy string) map[string]interface{} {
+	for k, v := range src {
+		existing, found := dst[k]
+		if !found {
+			dst[k] = v
+			continue
+		}
+		existingMap, existingIsMap := toStringMap(existing)
+		srcMap, srcIsMap := toStringMap(v)
+		if existingIsMap && srcIsMap {
+			dst[k] = mergeValues(existingMap, srcMap, listPolicy)
+			continue
+		}
+		existingList, existingIsList := existing.([]interface{})
+		srcList, srcIsList := v.([]interface{})
+		if existingIsList && srcIsList && listPolicy == ListMergeAppend {
+			dst[k] = append(append([]interface{}{}, existingList...), srcList...)
+			continue
+		}
+		dst[k] = v
+	}
+	return dst
+}
+
+// toStringMap converts any yaml map (and any nested maps) to a string keyed map
+func toStringMap(v interface{}) (map[string]interface{}, bool) {
+	switch typed := v.(type) {
+	case map[string]interface{}:
+		for k, nested := range typed {
+			typed[k] = normalizeValue(nested)
+		}
+		return typed, true
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(typed))
+		for k, nested := range typed {
+			m[fmt.Sprintf("%v", k)] = normalizeValue(nested)
+		}
+		return m, true
+	}
+	return nil, false
+}
+
+// normalizeValue converts yaml maps at any depth to string keyed maps
+func normalizeValue(v interface{}) interface{} {
+	if m, ok := toStringMap(v); ok {
+		return m
+	}
+	switch typed := v.(type) {
+	case []interface{}:
+		for i, item := range typed {
+			typed[i] = normalizeValue(item)
+		}
+		return typed
+	case []map[string]interface{}:
+		// e.g. a toml array of tables
+		l := make([]interface{}, len(typed))
+		for i, item := range typed {
+			l[i] = normalizeValue(item)
+		}
+		return l
+	case json.Number:
+		if i, err := typed.Int64(); err == nil {
+			return i
+		}
+		if f, err := typed.Float64(); err == nil {
+			return f
+		}
+		return typed.String()
+	}
+	return v
+}
+
+// setValues parses the --set, --set-string and --set-file flags (helm strvals
+// syntax) into the config data
+func setValues(c *cli.Context, conf map[string]interface{}) error {
+	for _, v := range c.StringSlice(FlagSet) {
+		if err := parseSetValue(FlagSet, v, func() error {
+			return strvals.ParseInto(v, conf)
+		}); err != nil {
+			return err
+		}
+	}
+	for _, v := range c.StringSlice(FlagSetString) {
+		if err := parseSetValue(FlagSetString, v, func() error {
+			return strvals.ParseIntoString(v, conf)
+		}); err != nil {
+			return err
+		}
+	}
+	reader := func(rs []rune) (interface{}, error) {
+		b, err := ioutil.ReadFile(string(rs))
+		return string(b), err
+	}
+	for _, v := range c.StringSlice(FlagSetFile) {
+		if err := parseSetValue(FlagSetFile, v, func() error {
+			return strvals.ParseIntoFile(v, conf, reader)
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseSetValue runs a strvals parse, the parser panics when a key conflicts
+// with the type of an existing value so this is returned as an error
+func parseSetValue(flag, value string, parse func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed parsing --%s %s: conflicts with existing config data", flag, value)
+		}
+	}()
+	if err := parse(); err != nil {
+		return fmt.Errorf("failed parsing --%s %s: %s", flag, value, err)
+	}
+	logDebug.Printf("set config data from --%s %s", flag, value)
+	return nil
+}
+
+// showConfig prints the final config data available to templates, leaving
+// out the environment at .Env as it repeats the top level
+func showConfig(conf interface{}, env map[string]interface{}) error {
+	if confMap, ok := conf.(map[string]interface{}); ok && reflect.DeepEqual(confMap[EnvScope], env) {
+		shown := make(map[string]interface{}, len(confMap))
+		for k, v := range confMap {
+			if k != EnvScope {
+				shown[k] = v
+			}
+		}
+		conf = shown
+	}
+	b, err := yaml.Marshal(conf)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(os.Stdout, redact(string(b)))
+	return nil
+}
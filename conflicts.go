@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// checkConflicts fails when rendered resources would overwrite each other
+// (the same api group, kind, namespace and name) or have a namespace which conflicts
+// with the --namespace flag, listing the files of all the conflicts
+func checkConflicts(c *cli.Context, resources []*ObjectResource) error {
+	namespace := c.String("namespace")
+	seen := map[string]*ObjectResource{}
+	var conflicts []string
+	for _, r := range resources {
+		if r.Kind == "" {
+			continue
+		}
+		clusterScoped := isClusterScoped(r.Kind)
+		if !clusterScoped && namespace != "" && r.Namespace != "" && r.Namespace != namespace {
+			conflicts = append(conflicts, fmt.Sprintf(
+				"%s/%s (from file:%q) has namespace %s which conflicts with --namespace %s",
+				strings.ToLower(r.Kind), r.Name, r.FileName, r.Namespace, namespace))
+		}
+		// Generated names never conflict
+		if r.Name == "" {
+			continue
+		}
+		resourceNamespace := r.Namespace
+		if resourceNamespace == "" && !clusterScoped {
+			resourceNamespace = namespace
+		}
+		// The same kind in different api groups are different resources
+		kind := strings.ToLower(r.Kind)
+		if group := apiGroup(r.APIVersion); group != "" {
+			kind += "." + group
+		}
+		key := kind + "/" + resourceNamespace + "/" + r.Name
+		first, found := seen[key]
+		if !found {
+			seen[key] = r
+			continue
+		}
+		location := ""
+		if resourceNamespace != "" {
+			location = " in namespace " + resourceNamespace
+		}
+		conflicts = append(conflicts, fmt.Sprintf(
+			"%s/%s%s is defined more than once (from files:%q and %q)",
+			kind, r.Name, location, first.FileName, r.FileName))
+	}
+	if len(conflicts) > 0 {
+		return fmt.Errorf("conflicting resources:\n%s", strings.Join(conflicts, "\n"))
+	}
+	return nil
+}
+
+// apiGroup gets the group of an apiVersion e.g. apps from apps/v1, the core
+// group (e.g. v1) is ""
+func apiGroup(apiVersion string) string {
+	if i := strings.LastIndex(apiVersion, "/"); i >= 0 {
+		return strings.ToLower(apiVersion[:i])
+	}
+	return ""
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestCheckConflicts(t *testing.T) {
+	resource := func(fn, kind, namespace, name string) *ObjectResource {
+		return &ObjectResource{
+			Kind:       kind,
+			FileName:   fn,
+			ObjectMeta: ObjectMeta{Name: name, Namespace: namespace},
+		}
+	}
+	cases := []struct {
+		name      string
+		namespace string
+		resources []*ObjectResource
+		want      string
+	}{
+		{
+			name: "no conflicts",
+			resources: []*ObjectResource{
+				resource("a.yaml", "Deployment", "", "app"),
+				resource("a.yaml", "Service", "", "app"),
+				resource("b.yaml", "Deployment", "other", "app"),
+				resource("b.yaml", "Job", "", ""),
+				resource("c.yaml", "Job", "", ""),
+			},
+		},
+		{
+			name:      "duplicate resources",
+			namespace: "dev",
+			resources: []*ObjectResource{
+				resource("a.yaml", "Deployment", "", "app"),
+				resource("b.yaml", "deployment", "dev", "app"),
+				resource("c.yaml", "ConfigMap", "", "app"),
+			},
+			want: "conflicting resources:\n" +
+				`deployment/app in namespace dev is defined more than once (from files:"a.yaml" and "b.yaml")`,
+		},
+		{
+			name:      "same kind in different api groups",
+			namespace: "dev",
+			resources: []*ObjectResource{
+				{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", FileName: "a.yaml", ObjectMeta: ObjectMeta{Name: "app"}},
+				{APIVersion: "traefik.io/v1alpha1", Kind: "Ingress", FileName: "b.yaml", ObjectMeta: ObjectMeta{Name: "app"}},
+			},
+		},
+		{
+			name:      "duplicate resources in an api group",
+			namespace: "dev",
+			resources: []*ObjectResource{
+				{APIVersion: "apps/v1", Kind: "Deployment", FileName: "a.yaml", ObjectMeta: ObjectMeta{Name: "app"}},
+				{APIVersion: "apps/v1beta2", Kind: "Deployment", FileName: "b.yaml", ObjectMeta: ObjectMeta{Name: "app"}},
+			},
+			want: "conflicting resources:\n" +
+				`deployment.apps/app in namespace dev is defined more than once (from files:"a.yaml" and "b.yaml")`,
+		},
+		{
+			name:      "conflicting namespaces",
+			namespace: "dev",
+			resources: []*ObjectResource{
+				resource("a.yaml", "Deployment", "prod", "app"),
+				resource("b.yaml", "Deployment", "dev", "app"),
+			},
+			want: "conflicting resources:\n" +
+				`deployment/app (from file:"a.yaml") has namespace prod which conflicts with --namespace dev`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := newTestContext([]cli.Flag{cli.StringFlag{Name: "namespace"}}, []string{"--namespace", c.namespace})
+			err := checkConflicts(ctx, c.resources)
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != c.want {
+				t.Errorf("got: %q\nwant: %q\n", got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gobwas/glob"
+)
+
+// IgnoreFile is the name of the file listing patterns to ignore in a directory
+const IgnoreFile = ".kdignore"
+
+// filePattern is a compiled glob matched against a relative path or base name
+type filePattern struct {
+	glob    glob.Glob
+	dirOnly bool
+}
+
+// FileFilter selects the files found when walking a directory
+type FileFilter struct {
+	Include []filePattern
+	Exclude []filePattern
+}
+
+// NewFileFilter creates a filter from include and exclude glob patterns
+func NewFileFilter(include, exclude []string) (*FileFilter, error) {
+	f := &FileFilter{}
+	var err error
+	if f.Include, err = compileFilePatterns(include); err != nil {
+		return nil, err
+	}
+	if f.Exclude, err = compileFilePatterns(exclude); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// compileFilePatterns compiles glob patterns, ** matches across directories
+// and a trailing / only matches directories
+func compileFilePatterns(patterns []string) ([]filePattern, error) {
+	var compiled []filePattern
+	for _, p := range patterns {
+		p = strings.TrimSpace(p)
+		if p == "" || strings.HasPrefix(p, "#") {
+			continue
+		}
+		dirOnly := strings.HasSuffix(p, "/")
+		g, err := glob.Compile(strings.Trim(p, "/"), '/')
+		if err != nil {
+			return nil, fmt.Errorf("invalid file pattern %q:%s", p, err)
+		}
+		compiled = append(compiled, filePattern{glob: g, dirOnly: dirOnly})
+	}
+	return compiled, nil
+}
+
+// matchesFilePatterns reports if a relative path matches any of the patterns
+func matchesFilePatterns(patterns []filePattern, rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	for _, p := range patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if p.glob.Match(rel) || p.glob.Match(path.Base(rel)) {
+			return true
+		}
+	}
+	return false
+}
+
+// readIgnoreFile reads the patterns from a .kdignore file if it exists
+func readIgnoreFile(dir string) ([]filePattern, error) {
+	f, err := os.Open(filepath.Join(dir, IgnoreFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+	var patterns []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	logDebug.Printf("ignoring files in %s matching %s", dir, IgnoreFile)
+	return compileFilePatterns(patterns)
+}
+
+// isIgnored reports if a path relative to the root directory is ignored by
+// the .kdignore file of any directory above it, like a .gitignore the
+// patterns are matched relative to the directory of the .kdignore file
+func isIgnored(ignores map[string][]filePattern, rel string, isDir bool) bool {
+	for dir := filepath.Dir(rel); ; dir = filepath.Dir(dir) {
+		if below, err := filepath.Rel(dir, rel); err == nil && matchesFilePatterns(ignores[dir], below, isDir) {
+			return true
+		}
+		if dir == "." {
+			return false
+		}
+	}
+}
+
+// ResourceSelector matches rendered resources by kind/name, the name may be a
+// glob e.g. deployment/* or configmap/app-*
+type ResourceSelector struct {
+	Kind string
+	Name string
+}
+
+// ParseResourceSelectors parses a list of kind/name selectors
+func ParseResourceSelectors(selectors []string) ([]ResourceSelector, error) {
+	var parsed []ResourceSelector
+	for _, s := range selectors {
+		parts := strings.Split(s, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid resource %s, expecting kind/name", s)
+		}
+		if _, err := path.Match(parts[1], ""); err != nil {
+			return nil, fmt.Errorf("invalid resource name pattern %s:%s", s, err)
+		}
+		parsed = append(parsed, ResourceSelector{Kind: parts[0], Name: parts[1]})
+	}
+	return parsed, nil
+}
+
+// Matches reports if a resource is of the kind and has a matching name
+func (s ResourceSelector) Matches(r *ObjectResource) bool {
+	if !kindMatches(s.Kind, r.Kind) {
+		return false
+	}
+	name := r.Name
+	if name == "" {
+		name = r.GenerateName
+	}
+	matched, _ := path.Match(s.Name, name)
+	return matched
+}
+
+// filterResources keeps only the resources matching any of the only
+// selectors (if any) and not matching any of the skip selectors
+func filterResources(resources []*ObjectResource, only, skip []ResourceSelector) []*ObjectResource {
+	var filtered []*ObjectResource
+	for _, r := range resources {
+		if len(only) > 0 && !matchesAnyResource(only, r) {
+			logDebug.Printf("skipping %s/%s not selected by only", r.Kind, r.Name)
+			continue
+		}
+		if matchesAnyResource(skip, r) {
+			logEvent(logInfo, resourceFields("skip", r), "skipping %s/%s (from file:%q)", strings.ToLower(r.Kind), r.Name, r.FileName)
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+	return filtered
+}
+
+// matchesAnyResource reports if a resource matches any of the selectors
+func matchesAnyResource(selectors []ResourceSelector, r *ObjectResource) bool {
+	for _, s := range selectors {
+		if s.Matches(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterResourcesByLabels keeps only the resources with labels matching a selector
+func filterResourcesByLabels(resources []*ObjectResource, selector LabelSelector) []*ObjectResource {
+	if len(selector) == 0 {
+		return resources
+	}
+	var filtered []*ObjectResource
+	for _, r := range resources {
+		if !selector.Matches(r.Labels) {
+			logDebug.Printf("skipping %s/%s not matching selector", r.Kind, r.Name)
+			continue
+		}
+		filtered = append(filtered, r)
+	}
+	return filtered
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestListDirectoryFiltered(t *testing.T) {
+	cases := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    []string
+	}{
+		{
+			name: "Honours the .kdignore files",
+			want: []string{
+				"test/TestFilter/app/configmap-dev.yaml",
+				"test/TestFilter/app/configmap.yaml",
+				"test/TestFilter/app/deployment.yaml",
+				"test/TestFilter/test/pod.yaml",
+			},
+		},
+		{
+			name:    "Excludes directories and files",
+			exclude: []string{"test/", "*-dev.yaml"},
+			want: []string{
+				"test/TestFilter/app/configmap.yaml",
+				"test/TestFilter/app/deployment.yaml",
+			},
+		},
+		{
+			name:    "Includes matching paths only",
+			include: []string{"app/**"},
+			exclude: []string{"app/configmap-*"},
+			want: []string{
+				"test/TestFilter/app/configmap.yaml",
+				"test/TestFilter/app/deployment.yaml",
+			},
+		},
+		{
+			name:    "Includes matching file names",
+			include: []string{"deployment.yaml", "pod.yaml"},
+			want: []string{
+				"test/TestFilter/app/deployment.yaml",
+				"test/TestFilter/test/pod.yaml",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			filter, err := NewFileFilter(c.include, c.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := ListDirectoryFiltered("test/TestFilter", filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
+func TestFilterResources(t *testing.T) {
+	resources := []*ObjectResource{
+		{Kind: "ConfigMap", ObjectMeta: ObjectMeta{Name: "app"}},
+		{Kind: "ConfigMap", ObjectMeta: ObjectMeta{Name: "app-dev"}},
+		{Kind: "Deployment", ObjectMeta: ObjectMeta{Name: "app"}},
+		{Kind: "Job", ObjectMeta: ObjectMeta{Name: "migrate"}},
+	}
+	cases := []struct {
+		name string
+		only []string
+		skip []string
+		want []string
+	}{
+		{
+			name: "Keeps all resources without selectors",
+			want: []string{"ConfigMap/app", "ConfigMap/app-dev", "Deployment/app", "Job/migrate"},
+		},
+		{
+			name: "Keeps only selected resources",
+			only: []string{"deploy/app", "configmap/app-*"},
+			want: []string{"ConfigMap/app-dev", "Deployment/app"},
+		},
+		{
+			name: "Skips selected resources",
+			skip: []string{"jobs/*", "ConfigMap/app"},
+			want: []string{"ConfigMap/app-dev", "Deployment/app"},
+		},
+		{
+			name: "Skip wins over only",
+			only: []string{"configmap/*"},
+			skip: []string{"configmap/*-dev"},
+			want: []string{"ConfigMap/app"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			only, err := ParseResourceSelectors(c.only)
+			if err != nil {
+				t.Fatal(err)
+			}
+			skip, err := ParseResourceSelectors(c.skip)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range filterResources(resources, only, skip) {
+				got = append(got, r.Kind+"/"+r.Name)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseResourceSelectorsInvalid(t *testing.T) {
+	for _, s := range []string{"deployment", "deployment/", "/app", "a/b/c", "deployment/[app"} {
+		if _, err := ParseResourceSelectors([]string{s}); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestFilterResourcesByLabels(t *testing.T) {
+	resources := []*ObjectResource{}
+	for _, doc := range []string{
+		"kind: Deployment\nmetadata:\n  name: web\n  labels:\n    app: foo\n    tier: web\n",
+		"kind: StatefulSet\nmetadata:\n  name: db\n  labels:\n    app: foo\n    tier: db\n",
+		"kind: Deployment\nmetadata:\n  name: other\n  labels:\n    app: bar\n    replicas: 2\n",
+		"kind: ConfigMap\nmetadata:\n  name: unlabelled\n",
+	} {
+		r := &ObjectResource{}
+		if err := yaml.Unmarshal([]byte(doc), r); err != nil {
+			t.Fatal(err)
+		}
+		resources = append(resources, r)
+	}
+	cases := []struct {
+		selector string
+		want     []string
+	}{
+		{selector: "", want: []string{"web", "db", "other", "unlabelled"}},
+		{selector: "app=foo,tier!=db", want: []string{"web"}},
+		{selector: "tier in (web, db)", want: []string{"web", "db"}},
+		{selector: "!app", want: []string{"unlabelled"}},
+		{selector: "replicas=2", want: []string{"other"}},
+	}
+	for _, c := range cases {
+		t.Run(c.selector, func(t *testing.T) {
+			selector, err := ParseLabelSelector(c.selector)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range filterResourcesByLabels(resources, selector) {
+				got = append(got, r.Name)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
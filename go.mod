@@ -3,27 +3,23 @@ module github.com/UKHomeOffice/kd
 go 1.16
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/Masterminds/semver v1.5.0 // indirect
 	github.com/Masterminds/sprig v2.15.0+incompatible
 	github.com/aokoli/goutils v1.0.1 // indirect
 	github.com/cavaliercoder/grab v2.0.0+incompatible
 	github.com/cyphar/filepath-securejoin v0.2.2 // indirect
-	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/ghodss/yaml v1.0.0 // indirect
-	github.com/gobwas/glob v0.2.3 // indirect
-	github.com/golang/protobuf v1.4.3 // indirect
-	github.com/google/uuid v0.0.0-20161128191214-064e2069ce9c // indirect
+	github.com/gobwas/glob v0.2.3
+	github.com/google/cel-go v0.10.1
 	github.com/huandu/xstrings v1.0.0 // indirect
-	github.com/imdario/mergo v0.0.0-20171009183408-7fe0c75c13ab // indirect
 	github.com/joho/godotenv v1.2.0
-	github.com/pkg/errors v0.9.1 // indirect
 	github.com/stretchr/testify v1.6.1 // indirect
 	github.com/urfave/cli v1.20.0
 	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519 // indirect
-	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
-	google.golang.org/protobuf v1.25.0 // indirect
 	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 	gopkg.in/yaml.v2 v2.4.0
 	k8s.io/apimachinery v0.0.0-20190207091153-095b9d203467 // indirect
 	k8s.io/helm v2.12.3+incompatible
+	sigs.k8s.io/kustomize/api v0.8.11
+	sigs.k8s.io/kustomize/kyaml v0.11.0
 )
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RecreateAnnotation allows kd to delete and recreate a resource when a
+// change can't be applied because it touches immutable fields
+const RecreateAnnotation = "kd.homeoffice.gov.uk/recreate-on-immutable-change"
+
+// immutableField is a field which can't be changed once a resource is created
+type immutableField struct {
+	Path   string
+	Reason string
+}
+
+// immutableFields are the immutable fields of the known kinds
+var immutableFields = map[string][]immutableField{
+	"deployment": {
+		{".spec.selector", "the selector of a Deployment can't be changed"},
+	},
+	"daemonset": {
+		{".spec.selector", "the selector of a DaemonSet can't be changed"},
+	},
+	"replicaset": {
+		{".spec.selector", "the selector of a ReplicaSet can't be changed"},
+	},
+	"statefulset": {
+		{".spec.selector", "the selector of a StatefulSet can't be changed"},
+		{".spec.serviceName", "the service name of a StatefulSet can't be changed"},
+		{".spec.podManagementPolicy", "the pod management policy of a StatefulSet can't be changed"},
+		{".spec.volumeClaimTemplates", "the volume claim templates of a StatefulSet can't be changed"},
+	},
+	"job": {
+		{".spec.selector", "the selector of a Job can't be changed"},
+		{".spec.template", "the pod template of a Job can't be changed"},
+	},
+	"service": {
+		{".spec.clusterIP", "the cluster IP of a Service can't be changed"},
+	},
+	"persistentvolumeclaim": {
+		{".spec.accessModes", "the access modes of a PersistentVolumeClaim can't be changed"},
+		{".spec.selector", "the selector of a PersistentVolumeClaim can't be changed"},
+		{".spec.storageClassName", "the storage class of a PersistentVolumeClaim can't be changed"},
+		{".spec.volumeMode", "the volume mode of a PersistentVolumeClaim can't be changed"},
+		{".spec.volumeName", "the volume of a PersistentVolumeClaim can't be changed"},
+	},
+}
+
+// immutableDataFields are the fields of a ConfigMap or Secret marked immutable
+var immutableDataFields = []immutableField{
+	{".data", "the data of an immutable %s can't be changed"},
+	{".binaryData", "the data of an immutable %s can't be changed"},
+}
+
+// immutableFieldsFor gets the immutable fields of a live object
+func immutableFieldsFor(kind string, live map[string]interface{}) []immutableField {
+	kind = strings.ToLower(kind)
+	if (kind == "configmap" || kind == "secret") && live["immutable"] == true {
+		var fields []immutableField
+		for _, f := range immutableDataFields {
+			fields = append(fields, immutableField{f.Path, fmt.Sprintf(f.Reason, kind)})
+		}
+		return fields
+	}
+	return immutableFields[kind]
+}
+
+// immutableChanges lists the immutable fields a resource would change, only
+// fields set in the resource are compared so defaults set by the api server
+// are ignored
+func immutableChanges(kind string, desired, live map[string]interface{}) []immutableField {
+	var changes []immutableField
+	for _, f := range immutableFieldsFor(kind, live) {
+		want, found := valueAtPath(desired, f.Path)
+		if !found {
+			continue
+		}
+		got, _ := valueAtPath(live, f.Path)
+		if !isSubset(want, got, false) {
+			changes = append(changes, f)
+		}
+	}
+	return changes
+}
+
+// isSubset reports if all the values set in desired match those in live,
+// values under resources are compared as quantities as the api server
+// normalises them (e.g. cpu: 0.5 is returned as 500m)
+func isSubset(desired, live interface{}, quantities bool) bool {
+	// An empty value is the same as the field not being set
+	if isEmptyValue(desired) {
+		return true
+	}
+	if desiredMap, ok := toStringMap(desired); ok {
+		liveMap, ok := toStringMap(live)
+		if !ok {
+			return false
+		}
+		for k, v := range desiredMap {
+			if !isSubset(v, liveMap[k], quantities || k == "resources") {
+				return false
+			}
+		}
+		return true
+	}
+	if desiredList, ok := desired.([]interface{}); ok {
+		liveList, ok := live.([]interface{})
+		if !ok || len(desiredList) != len(liveList) {
+			return false
+		}
+		for i := range desiredList {
+			if !isSubset(desiredList[i], liveList[i], quantities) {
+				return false
+			}
+		}
+		return true
+	}
+	if quantities {
+		want, wantOK := parseQuantity(desired)
+		got, gotOK := parseQuantity(live)
+		if wantOK && gotOK {
+			return want.Cmp(got) == 0
+		}
+	}
+	// Compare scalars as strings as yaml and json numbers differ in type
+	return fmt.Sprintf("%v", desired) == fmt.Sprintf("%v", live)
+}
+
+// quantitySuffixes are the multipliers of the kubernetes quantity suffixes
+var quantitySuffixes = map[string]string{
+	"n": "1/1000000000", "u": "1/1000000", "m": "1/1000",
+	"k": "1e3", "M": "1e6", "G": "1e9", "T": "1e12", "P": "1e15", "E": "1e18",
+	"Ki": "1024", "Mi": "1048576", "Gi": "1073741824", "Ti": "1099511627776",
+	"Pi": "1125899906842624", "Ei": "1152921504606846976",
+}
+
+// parseQuantity parses a kubernetes quantity e.g. 0.5, 500m, 1e3 or 1Gi
+func parseQuantity(v interface{}) (*big.Rat, bool) {
+	s := strings.TrimSpace(fmt.Sprintf("%v", v))
+	multiplier := "1"
+	for _, n := range []int{2, 1} {
+		if len(s) > n {
+			if m, ok := quantitySuffixes[s[len(s)-n:]]; ok {
+				s, multiplier = s[:len(s)-n], m
+				break
+			}
+		}
+	}
+	if strings.Contains(s, "/") {
+		return nil, false
+	}
+	q, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, false
+	}
+	m, _ := new(big.Rat).SetString(multiplier)
+	return q.Mul(q, m), true
+}
+
+// isEmptyValue reports if a value is nil or an empty map or list
+func isEmptyValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	if m, ok := toStringMap(v); ok {
+		return len(m) == 0
+	}
+	if l, ok := v.([]interface{}); ok {
+		return len(l) == 0
+	}
+	return false
+}
+
+// checkImmutableChanges reports if a resource must be recreated to apply a
+// change to immutable fields, failing with an explanation of the fields
+// unless the resource is annotated to allow it to be recreated. A resource
+// which can't be fetched (e.g. without RBAC to get it) is applied as normal.
+func checkImmutableChanges(k8api K8Api, r *ObjectResource) (bool, error) {
+	kind := strings.ToLower(r.Kind)
+	if r.Name == "" || (immutableFields[kind] == nil && kind != "configmap" && kind != "secret") {
+		return false, nil
+	}
+	live, err := k8api.Get(r.Namespace, r.Kind, r.Name)
+	if err != nil {
+		if !isNotFound(err) {
+			logInfo.Printf("warning: unable to check %s/%s for immutable field changes, applying anyway:%s",
+				strings.ToLower(r.Kind), r.Name, err)
+		}
+		return false, nil
+	}
+	desired, err := decodeTemplate(r.Template)
+	if err != nil {
+		return false, err
+	}
+	changes := immutableChanges(r.Kind, desired, live)
+	if len(changes) == 0 {
+		return false, nil
+	}
+	var reasons []string
+	for _, f := range changes {
+		reasons = append(reasons, fmt.Sprintf("%s: %s", f.Path, f.Reason))
+	}
+	sort.Strings(reasons)
+	if r.Annotations[RecreateAnnotation] == "true" {
+		logEvent(logInfo, resourceFields("recreate", r), "recreating %s/%s as immutable fields have changed:\n%s",
+			strings.ToLower(r.Kind), r.Name, strings.Join(reasons, "\n"))
+		return true, nil
+	}
+	return false, fmt.Errorf(
+		"cannot apply %s/%s (from file:%q) as immutable fields have changed:\n%s\n"+
+			"add the annotation %s: \"true\" to delete and recreate it",
+		strings.ToLower(r.Kind), r.Name, r.FileName, strings.Join(reasons, "\n"), RecreateAnnotation)
+}
+
+// decodeTemplate decodes the template of a resource as structured data
+func decodeTemplate(template []byte) (map[string]interface{}, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(template, &doc); err != nil {
+		return nil, err
+	}
+	obj, _ := toStringMap(doc)
+	return obj, nil
+}
+
+// deleteResource deletes a resource, waiting for it to be removed
+func deleteResource(c *cli.Context, r *ObjectResource) error {
+	cmd, err := newKubeCmd(c, []string{"delete", "--wait=true", "-f", "-"}, false)
+	if err != nil {
+		return err
+	}
+	var outbuf, errbuf bytes.Buffer
+	cmd.Stdin = bytes.NewReader(r.Template)
+	cmd.Stdout = &outbuf
+	cmd.Stderr = &errbuf
+	logEvent(logInfo, resourceFields("delete", r), "deleting %s/%s", strings.ToLower(r.Kind), r.Name)
+	if err := cmd.Run(); err != nil {
+		if errbuf.Len() > 0 {
+			return errors.New(redact(errbuf.String()))
+		}
+		return err
+	}
+	logInfo.Print(outbuf.String())
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestCheckImmutableChanges(t *testing.T) {
+	api := stubK8Api{objects: map[string]map[string]interface{}{
+		"/Job/migrate": {
+			"kind":     "Job",
+			"metadata": map[string]interface{}{"name": "migrate"},
+			"spec": map[string]interface{}{
+				"selector": map[string]interface{}{"matchLabels": map[string]interface{}{"controller-uid": "1234"}},
+				"template": map[string]interface{}{
+					"metadata": map[string]interface{}{"labels": map[string]interface{}{"controller-uid": "1234", "app": "migrate"}},
+					"spec": map[string]interface{}{
+						"restartPolicy": "Never",
+						"containers": []interface{}{map[string]interface{}{
+							"name":            "migrate",
+							"image":           "migrate:v1",
+							"imagePullPolicy": "IfNotPresent",
+							"ports":           []interface{}{map[string]interface{}{"containerPort": float64(8080), "protocol": "TCP"}},
+						}},
+					},
+				},
+			},
+		},
+		"/Service/app": {
+			"kind":     "Service",
+			"metadata": map[string]interface{}{"name": "app"},
+			"spec":     map[string]interface{}{"clusterIP": "10.0.0.1", "type": "ClusterIP"},
+		},
+		"/ConfigMap/app": {
+			"kind":      "ConfigMap",
+			"metadata":  map[string]interface{}{"name": "app"},
+			"immutable": true,
+			"data":      map[string]interface{}{"key": "v1"},
+		},
+	}}
+	job := `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+%s
+spec:
+  template:
+    metadata:
+      labels:
+        app: migrate
+    spec:
+      restartPolicy: Never
+      containers:
+      - name: migrate
+        image: %s
+        ports:
+        - containerPort: 8080
+        resources: {}
+`
+	cases := []struct {
+		name         string
+		template     string
+		wantRecreate bool
+		wantError    string
+	}{
+		{
+			name:     "unchanged job with server defaults",
+			template: strings.Replace(strings.Replace(job, "%s", "", 1), "%s", "migrate:v1", 1),
+		},
+		{
+			name:      "changed job template",
+			template:  strings.Replace(strings.Replace(job, "%s", "", 1), "%s", "migrate:v2", 1),
+			wantError: ".spec.template: the pod template of a Job can't be changed",
+		},
+		{
+			name: "changed job template annotated to recreate",
+			template: strings.Replace(strings.Replace(job, "%s",
+				"  annotations:\n    kd.homeoffice.gov.uk/recreate-on-immutable-change: \"true\"", 1), "%s", "migrate:v2", 1),
+			wantRecreate: true,
+		},
+		{
+			name:     "service without a cluster IP",
+			template: "apiVersion: v1\nkind: Service\nmetadata:\n  name: app\nspec:\n  type: NodePort\n",
+		},
+		{
+			name:      "service with a changed cluster IP",
+			template:  "apiVersion: v1\nkind: Service\nmetadata:\n  name: app\nspec:\n  clusterIP: 10.0.0.2\n",
+			wantError: ".spec.clusterIP: the cluster IP of a Service can't be changed",
+		},
+		{
+			name:      "immutable configmap",
+			template:  "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\nimmutable: true\ndata:\n  key: v2\n",
+			wantError: ".data: the data of an immutable configmap can't be changed",
+		},
+		{
+			name:     "new resource",
+			template: "apiVersion: v1\nkind: Service\nmetadata:\n  name: new\nspec:\n  clusterIP: 10.0.0.2\n",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := &ObjectResource{FileName: "app.yaml", Template: []byte(c.template)}
+			if err := yaml.Unmarshal(r.Template, r); err != nil {
+				t.Fatal(err)
+			}
+			recreate, err := checkImmutableChanges(api, r)
+			if c.wantError != "" {
+				if err == nil || !strings.Contains(err.Error(), c.wantError) {
+					t.Errorf("got error: %v\nwant: %s", err, c.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if recreate != c.wantRecreate {
+				t.Errorf("got recreate: %t, want: %t", recreate, c.wantRecreate)
+			}
+		})
+	}
+}
+
+func TestCheckImmutableChangesGetError(t *testing.T) {
+	api := stubK8Api{err: errors.New("services \"app\" is forbidden")}
+	r := &ObjectResource{
+		Kind:       "Service",
+		ObjectMeta: ObjectMeta{Name: "app"},
+		Template:   []byte("apiVersion: v1\nkind: Service\nmetadata:\n  name: app\nspec:\n  clusterIP: 10.0.0.2\n"),
+	}
+	recreate, err := checkImmutableChanges(api, r)
+	if err != nil || recreate {
+		t.Errorf("expected a normal apply when the resource can't be fetched, got recreate: %t error: %v", recreate, err)
+	}
+}
+
+func TestImmutableChangesQuantities(t *testing.T) {
+	live := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"spec": map[string]interface{}{
+					"containers": []interface{}{map[string]interface{}{
+						"name": "migrate",
+						"resources": map[string]interface{}{
+							"limits":   map[string]interface{}{"cpu": "1", "memory": "1Gi"},
+							"requests": map[string]interface{}{"cpu": "500m", "memory": "512Mi"},
+						},
+					}},
+				},
+			},
+		},
+	}
+	cases := []struct {
+		name     string
+		template string
+		want     int
+	}{
+		{
+			name:     "Check quantities normalised by the api server are unchanged",
+			template: "spec:\n  template:\n    spec:\n      containers:\n      - name: migrate\n        resources:\n          limits:\n            cpu: 1000m\n            memory: 1024Mi\n          requests:\n            cpu: 0.5\n            memory: 0.5Gi\n",
+		},
+		{
+			name:     "Check changed quantities are reported",
+			template: "spec:\n  template:\n    spec:\n      containers:\n      - name: migrate\n        resources:\n          requests:\n            cpu: 0.25\n",
+			want:     1,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			desired, err := decodeTemplate([]byte(c.template))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := immutableChanges("Job", desired, live); len(got) != c.want {
+				t.Errorf("got %d changes: %v, want: %d", len(got), got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// kindShortNames maps kubectl short names to kinds
+var kindShortNames = map[string]string{
+	"cm":     "configmap",
+	"cj":     "cronjob",
+	"deploy": "deployment",
+	"ds":     "daemonset",
+	"ep":     "endpoints",
+	"hpa":    "horizontalpodautoscaler",
+	"ing":    "ingress",
+	"netpol": "networkpolicy",
+	"no":     "node",
+	"ns":     "namespace",
+	"pdb":    "poddisruptionbudget",
+	"po":     "pod",
+	"pv":     "persistentvolume",
+	"pvc":    "persistentvolumeclaim",
+	"rs":     "replicaset",
+	"sa":     "serviceaccount",
+	"sc":     "storageclass",
+	"sts":    "statefulset",
+	"svc":    "service",
+}
+
+var (
+	// pathSegment matches a field and optional indexes in a lookup path e.g. ports[0]
+	pathSegment = regexp.MustCompile(`^([^\[\]]*)((?:\[\d+\])*)$`)
+	// pathIndex matches each index of a path segment
+	pathIndex = regexp.MustCompile(`\d+`)
+)
+
+// K8ApiFixtures is a K8Api serving objects loaded from fixture files
+type K8ApiFixtures struct {
+	// Namespace is used when no namespace is specified for a lookup
+	Namespace string
+	objects   []map[string]interface{}
+}
+
+// NewK8ApiFixtures creates a K8Api serving the objects in yaml files or
+// directories of yaml files
+func NewK8ApiFixtures(paths []string, namespace string) (K8Api, error) {
+	api := &K8ApiFixtures{
+		Namespace: namespace,
+	}
+	for _, p := range paths {
+		stat, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{p}
+		if stat.IsDir() {
+			if files, err = ListDirectory(p); err != nil {
+				return nil, err
+			}
+		}
+		for _, f := range files {
+			if err := api.load(f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return api, nil
+}
+
+// load adds all the objects (and the items of any lists) from a file
+func (a *K8ApiFixtures) load(f string) error {
+	data, err := ioutil.ReadFile(f)
+	if err != nil {
+		return err
+	}
+	for _, d := range splitYamlDocs(string(data)) {
+		var doc interface{}
+		if err := yaml.Unmarshal([]byte(d), &doc); err != nil {
+			return fmt.Errorf("error parsing lookup fixture file '%s':%s", f, err)
+		}
+		obj, ok := toStringMap(doc)
+		if !ok {
+			continue
+		}
+		if items, ok := obj["items"].([]interface{}); ok {
+			for _, item := range items {
+				if itemObj, ok := toStringMap(item); ok {
+					a.objects = append(a.objects, itemObj)
+				}
+			}
+			continue
+		}
+		a.objects = append(a.objects, obj)
+	}
+	logDebug.Printf("loaded lookup fixtures from %s", f)
+	return nil
+}
+
+// Lookup will get data from a specified fixture object
+func (a K8ApiFixtures) Lookup(kind, name, path string) (string, error) {
+	return a.LookupNamespace("", kind, name, path)
+}
+
+// LookupNamespace will get data from a specified fixture object in a namespace
+func (a K8ApiFixtures) LookupNamespace(namespace, kind, name, path string) (string, error) {
+	obj, err := a.Get(namespace, kind, name)
+	if err != nil {
+		return "", err
+	}
+	value, found := valueAtPath(obj, path)
+	if !found {
+		// Matches kubectl custom-columns output for a missing field
+		return "<none>", nil
+	}
+	return fmt.Sprintf("%v", value), nil
+}
+
+// Get will get a fixture object
+func (a K8ApiFixtures) Get(namespace, kind, name string) (map[string]interface{}, error) {
+	for _, obj := range a.objects {
+		if a.matches(obj, namespace, kind) && objectName(obj) == name {
+			return obj, nil
+		}
+	}
+	return nil, NotFoundError{Kind: kind, Name: name}
+}
+
+// List will get all fixture objects of a kind matching a label selector
+func (a K8ApiFixtures) List(namespace, kind, selector string) ([]interface{}, error) {
+	s, err := ParseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	items := []interface{}{}
+	for _, obj := range a.objects {
+		if a.matches(obj, namespace, kind) && s.Matches(objectLabels(obj)) {
+			items = append(items, obj)
+		}
+	}
+	return items, nil
+}
+
+// matches reports if an object is of a kind and in a namespace, objects
+// without a namespace are treated as cluster scoped
+func (a K8ApiFixtures) matches(obj map[string]interface{}, namespace, kind string) bool {
+	if !kindMatches(kind, fmt.Sprintf("%v", obj["kind"])) {
+		return false
+	}
+	if namespace == "" {
+		namespace = a.Namespace
+	}
+	objNamespace := objectNamespace(obj)
+	return namespace == "" || objNamespace == "" || objNamespace == namespace
+}
+
+// kindMatches reports if a kind as specified to kubectl (e.g. pv, pvs,
+// persistentvolume or PersistentVolume) refers to a kind
+func kindMatches(query, kind string) bool {
+	query = strings.ToLower(query)
+	kind = strings.ToLower(kind)
+	if full, ok := kindShortNames[query]; ok {
+		query = full
+	}
+	// Ignore any api group e.g. deployments.apps
+	query = strings.SplitN(query, ".", 2)[0]
+	return query == kind || query == kind+"s" || query == kind+"es" ||
+		(strings.HasSuffix(kind, "y") && query == strings.TrimSuffix(kind, "y")+"ies")
+}
+
+// objectMetadata gets the metadata of an object
+func objectMetadata(obj map[string]interface{}) map[string]interface{} {
+	meta, _ := toStringMap(obj["metadata"])
+	return meta
+}
+
+// objectName gets the name of an object
+func objectName(obj map[string]interface{}) string {
+	name, _ := objectMetadata(obj)["name"].(string)
+	return name
+}
+
+// objectNamespace gets the namespace of an object
+func objectNamespace(obj map[string]interface{}) string {
+	namespace, _ := objectMetadata(obj)["namespace"].(string)
+	return namespace
+}
+
+// objectLabels gets the labels of an object
+func objectLabels(obj map[string]interface{}) map[string]string {
+	labels := map[string]string{}
+	values, _ := toStringMap(objectMetadata(obj)["labels"])
+	for k, v := range values {
+		labels[k] = fmt.Sprintf("%v", v)
+	}
+	return labels
+}
+
+// valueAtPath gets a value using a kubectl custom-columns style path e.g.
+// .spec.containers[0].image
+func valueAtPath(obj interface{}, path string) (interface{}, bool) {
+	current := obj
+	for _, segment := range strings.Split(strings.TrimPrefix(path, "."), ".") {
+		m := pathSegment.FindStringSubmatch(segment)
+		if m == nil {
+			return nil, false
+		}
+		if m[1] != "" {
+			values, ok := toStringMap(current)
+			if !ok {
+				return nil, false
+			}
+			if current, ok = values[m[1]]; !ok {
+				return nil, false
+			}
+		}
+		for _, index := range pathIndex.FindAllString(m[2], -1) {
+			list, ok := current.([]interface{})
+			i, _ := strconv.Atoi(index)
+			if !ok || i >= len(list) {
+				return nil, false
+			}
+			current = list[i]
+		}
+	}
+	return current, true
+}
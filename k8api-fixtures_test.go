@@ -0,0 +1,67 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestK8ApiFixtures(t *testing.T) {
+	api, err := NewK8ApiFixtures([]string{"test/TestLookupFixtures/"}, "testing")
+	if err != nil {
+		t.Fatalf("unexpected error loading fixtures: %s", err)
+	}
+
+	cases := []struct {
+		name      string
+		inputdata string
+		want      string
+	}{
+		{
+			name:      "Check k8lookup finds a value by short name",
+			inputdata: `{{ k8lookup "pv" "sysdig-mysql-a" ".spec.capacity.storage" }}`,
+			want:      "20Gi",
+		},
+		{
+			name:      "Check k8lookup uses the configured namespace",
+			inputdata: `{{ k8lookup "configmap" "database" ".data.host" }}`,
+			want:      "db.testing.svc",
+		},
+		{
+			name:      "Check k8lookup supports indexes",
+			inputdata: `{{ k8lookup "cm" "database" ".ports[0]" }}`,
+			want:      "5432",
+		},
+		{
+			name:      "Check k8lookup of a missing field",
+			inputdata: `{{ k8lookup "cm" "database" ".data.missing" }}`,
+			want:      "<none>",
+		},
+		{
+			name:      "Check k8lookupIn finds a value in another namespace",
+			inputdata: `{{ k8lookupIn "shared" "ConfigMap" "database" ".data.host" }}`,
+			want:      "db.shared.svc",
+		},
+		{
+			name:      "Check k8list filters by label selector",
+			inputdata: `{{ range k8list "" "persistentvolumes" "name=sysdig-mysql" }}{{ .metadata.name }}={{ .spec.capacity.storage }} {{ end }}`,
+			want:      "sysdig-mysql-a=20Gi sysdig-mysql-b=30Gi ",
+		},
+		{
+			name:      "Check k8lookupDefault of a missing object",
+			inputdata: `{{ k8lookupDefault "pv" "missing" ".spec.capacity.storage" "10Gi" }}`,
+			want:      "10Gi",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, _, err := Render(api, c.inputdata, emptymap)
+			if err != nil {
+				t.Errorf("unexpected error rendering: %s", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
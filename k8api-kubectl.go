@@ -1,8 +1,9 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
-	"io/ioutil"
 	"strings"
 
 	"github.com/urfave/cli"
@@ -24,26 +25,77 @@ func NewK8ApiKubectl(c *cli.Context) K8Api {
 
 // Lookup will get data from a specified kubernetes object
 func (a K8ApiKubectl) Lookup(kind, name, path string) (string, error) {
-	args := []string{"get", kind + "/" + name, "-o", "custom-columns=:" + path, "--no-headers"}
+	return a.LookupNamespace("", kind, name, path)
+}
 
-	cmd, err := newKubeCmd(a.Cx, args, false)
+// LookupNamespace will get data from a specified kubernetes object in a namespace
+func (a K8ApiKubectl) LookupNamespace(namespace, kind, name, path string) (string, error) {
+	args := []string{"get", kind + "/" + name, "-o", "custom-columns=:" + path, "--no-headers"}
+	data, err := a.get(namespace, kind, name, args)
 	if err != nil {
 		return "", err
 	}
-	stderr, _ := cmd.StderrPipe()
-	stdout, _ := cmd.StdoutPipe()
-	if err := cmd.Start(); err != nil {
-		logDebug.Printf("error starting kubectl: %s", err)
-		return "", err
+	return strings.TrimSpace(string(data[:])), nil
+}
+
+// Get will get a kubernetes object as structured data
+func (a K8ApiKubectl) Get(namespace, kind, name string) (map[string]interface{}, error) {
+	args := []string{"get", kind + "/" + name, "-o", "json"}
+	data, err := a.get(namespace, kind, name, args)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := decodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s/%s:%s", kind, name, err)
+	}
+	objMap, _ := toStringMap(obj)
+	return objMap, nil
+}
+
+// List will get all kubernetes objects of a kind matching a label selector
+func (a K8ApiKubectl) List(namespace, kind, selector string) ([]interface{}, error) {
+	args := []string{"get", kind, "-o", "json"}
+	if selector != "" {
+		args = append(args, "--selector="+selector)
 	}
-	data, _ := ioutil.ReadAll(stdout)
-	if err := cmd.Wait(); err != nil {
+	data, err := a.get(namespace, kind, "", args)
+	if err != nil {
+		return nil, err
+	}
+	list, err := decodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s list:%s", kind, err)
+	}
+	listMap, _ := toStringMap(list)
+	if items, ok := listMap["items"].([]interface{}); ok {
+		return items, nil
+	}
+	return []interface{}{}, nil
+}
+
+// get runs a kubectl get command returning stdout or a NotFoundError
+func (a K8ApiKubectl) get(namespace, kind, name string, args []string) ([]byte, error) {
+	// A namespace specified after the global flags takes precedence
+	if namespace != "" {
+		args = append(args, "--namespace="+namespace)
+	}
+	cmd, err := newKubeCmd(a.Cx, args, false)
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
 		logDebug.Printf("error with kubectl: %s", err)
-		errData, _ := ioutil.ReadAll(stderr)
-		if strings.Contains("NotFound", string(errData[:])) {
-			return "", fmt.Errorf("Error object %s/%s not found", kind, name)
+		if strings.Contains(stderr.String(), "NotFound") {
+			return nil, NotFoundError{Kind: kind, Name: name}
 		}
-		return "", err
+		if stderr.Len() > 0 {
+			return nil, errors.New(redact(strings.TrimSpace(stderr.String())))
+		}
+		return nil, err
 	}
-	return strings.TrimSpace(string(data[:])), nil
+	return stdout.Bytes(), nil
 }
@@ -14,3 +14,24 @@ func NewK8ApiNoop() K8Api {
 func (a K8ApiNoop) Lookup(kind, name, path string) (string, error) {
 	return "noop", nil
 }
+
+// LookupNamespace will pretend to get data from a specified kubernetes object
+func (a K8ApiNoop) LookupNamespace(namespace, kind, name, path string) (string, error) {
+	return "noop", nil
+}
+
+// Get will pretend to get a kubernetes object, returning only the identifying fields
+func (a K8ApiNoop) Get(namespace, kind, name string) (map[string]interface{}, error) {
+	return map[string]interface{}{
+		"kind": kind,
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": namespace,
+		},
+	}, nil
+}
+
+// List will pretend to list kubernetes objects, finding none
+func (a K8ApiNoop) List(namespace, kind, selector string) ([]interface{}, error) {
+	return []interface{}{}, nil
+}
@@ -1,7 +1,37 @@
 package main
 
+import "fmt"
+
 // K8Api is an abstraction to allow the migration to the real API not kubectl
 type K8Api interface {
 	// Lookup abstract interface for finding kuberneets api data by kind, name and path
 	Lookup(kind, name, path string) (string, error)
+
+	// LookupNamespace finds kubernetes api data by kind, name and path in a
+	// namespace ("" for the current namespace)
+	LookupNamespace(namespace, kind, name, path string) (string, error)
+
+	// Get finds a kubernetes object by kind and name in a namespace ("" for the
+	// current namespace) as structured data
+	Get(namespace, kind, name string) (map[string]interface{}, error)
+
+	// List finds all kubernetes objects of a kind matching a label selector ("" for
+	// all objects) in a namespace ("" for the current namespace) as structured data
+	List(namespace, kind, selector string) ([]interface{}, error)
+}
+
+// NotFoundError is returned by a K8Api when an object does not exist
+type NotFoundError struct {
+	Kind string
+	Name string
+}
+
+func (e NotFoundError) Error() string {
+	return fmt.Sprintf("Error object %s/%s not found", e.Kind, e.Name)
+}
+
+// isNotFound reports if an error is a NotFoundError
+func isNotFound(err error) bool {
+	_, ok := err.(NotFoundError)
+	return ok
 }
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"fmt"
+
+	"sigs.k8s.io/kustomize/api/krusty"
+	"sigs.k8s.io/kustomize/kyaml/filesys"
+)
+
+// buildKustomization builds the resources of a kustomization directory as a
+// multi-document yaml stream, as `kustomize build` would
+func buildKustomization(dir string) (string, error) {
+	k := krusty.MakeKustomizer(krusty.MakeDefaultOptions())
+	resMap, err := k.Run(filesys.MakeFsOnDisk(), dir)
+	if err != nil {
+		return "", fmt.Errorf("error building kustomization '%s':%s", dir, err)
+	}
+	data, err := resMap.AsYaml()
+	if err != nil {
+		return "", fmt.Errorf("error building kustomization '%s':%s", dir, err)
+	}
+	logDebug.Printf("built %d resources from kustomization %s", resMap.Size(), dir)
+	return string(data), nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestRenderKustomization(t *testing.T) {
+	cases := []struct {
+		name   string
+		render bool
+		want   []string
+		image  string
+	}{
+		{
+			name:  "Built resources are not templated by default",
+			want:  []string{"Deployment/prod-app", "ConfigMap/prod-app"},
+			image: "app:{{ .VERSION }}",
+		},
+		{
+			name:   "Built resources are templated when enabled",
+			render: true,
+			want:   []string{"Deployment/prod-app", "ConfigMap/prod-app"},
+			image:  "app:v1.2.3",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			data, err := buildKustomization("test/TestKustomize/overlay")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ctx := newTestContext(nil, nil)
+			conf := map[string]interface{}{"VERSION": "v1.2.3"}
+			resources, err := renderFile(ctx, &K8ApiNoop{}, conf, "test/TestKustomize/overlay", data, c.render)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range resources {
+				if err := yaml.Unmarshal(r.Template, r); err != nil {
+					t.Fatal(err)
+				}
+				if r.Labels["env"] != "prod" {
+					t.Errorf("expected the env label on %s/%s", r.Kind, r.Name)
+				}
+				got = append(got, r.Kind+"/"+r.Name)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+			if !strings.Contains(string(resources[0].Template), c.image) {
+				t.Errorf("expected image %s in:\n%s", c.image, resources[0].Template)
+			}
+		})
+	}
+}
+
+func TestBuildKustomizationMissing(t *testing.T) {
+	if _, err := buildKustomization("test/TestKustomize/missing"); err == nil {
+		t.Error("expected an error for a missing kustomization")
+	}
+}
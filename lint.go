@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// LintSeverityError is a finding which will fail a deployment
+	LintSeverityError = "error"
+	// LintSeverityWarning is a finding which may indicate a problem
+	LintSeverityWarning = "warning"
+
+	// LintFormatText reports findings as file:line: severity: [rule] message
+	LintFormatText = "text"
+	// LintFormatJSON reports findings as a JSON array
+	LintFormatJSON = "json"
+)
+
+var (
+	// templateError matches a text/template parse error e.g.
+	// template: template:3: function "foo" not defined
+	templateError = regexp.MustCompile(`^template: [^:]*:(\d+):(?:\d+:)? (.*)$`)
+	// yamlErrorLine matches the line of a yaml error e.g. yaml: line 3: ...
+	yamlErrorLine = regexp.MustCompile(`line (\d+)`)
+	// yamlDocSeparator is the separator used by splitYamlDocs
+	yamlDocSeparator = regexp.MustCompile(`(?m)^---\n`)
+)
+
+// LintFinding is a single problem found with a template
+type LintFinding struct {
+	File     string `json:"file"`
+	Line     int    `json:"line,omitempty"`
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+// lintDoc is a yaml document and the line it starts on
+type lintDoc struct {
+	Line    int
+	Content string
+}
+
+// lintTemplates is the lint command action
+func lintTemplates(c *cli.Context) error {
+	parent := c.Parent()
+	if err := setupLogging(parent); err != nil {
+		return err
+	}
+	setupRedaction(parent)
+	// Keep stdout for the findings only
+	logInfo.SetOutput(newLogWriter(os.Stderr, LogLevelInfo))
+	format := c.String("format")
+	if format != LintFormatText && format != LintFormatJSON {
+		return fmt.Errorf("invalid format %q, expecting %s or %s", format, LintFormatText, LintFormatJSON)
+	}
+	if len(parent.StringSlice("file")) == 0 {
+		return fmt.Errorf("no kubernetes resource files specified")
+	}
+	conf, err := GetAnyConfigData(parent)
+	if err != nil {
+		return err
+	}
+	files, err := listFiles(parent)
+	if err != nil {
+		return err
+	}
+	k8api, err := newOfflineK8Api(parent)
+	if err != nil {
+		return err
+	}
+	if parent.IsSet(FlagAllowMissing) {
+		allowMissingVariables = true
+	}
+
+	l := &linter{
+		conf:      conf,
+		k8api:     k8api,
+		preRender: parent.IsSet(FlagPreRenderTemplates),
+		used:      map[string]bool{},
+	}
+	var findings []LintFinding
+	for _, fn := range files {
+		data, err := readResourceFile(fn)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, l.lintFile(fn, string(data))...)
+	}
+	findings = append(findings, l.unusedConfigData()...)
+
+	if err := writeLintFindings(os.Stdout, format, findings); err != nil {
+		return err
+	}
+	for _, f := range findings {
+		if f.Severity == LintSeverityError {
+			return cli.NewExitError("", 1)
+		}
+	}
+	return nil
+}
+
+// linter checks templates against the config data
+type linter struct {
+	conf      interface{}
+	k8api     K8Api
+	preRender bool
+	// used records the config data paths referenced by any template
+	used map[string]bool
+}
+
+// lintFile checks all the templates in a file
+func (l *linter) lintFile(fn, data string) []LintFinding {
+	logDebug.Printf("linting file:%s\n", fn)
+	docs := []lintDoc{{Line: 1, Content: data}}
+	if !l.preRender {
+		docs = splitYamlDocsWithLines(data)
+	}
+	var findings []LintFinding
+	for _, doc := range docs {
+		t, err := template.New("template").Funcs(funcMap()).Parse(doc.Content)
+		if err != nil {
+			findings = append(findings, templateFinding(fn, doc.Line, err))
+			continue
+		}
+		findings = append(findings, l.checkReferences(fn, doc, t)...)
+		findings = append(findings, l.checkRendered(fn, doc)...)
+	}
+	return findings
+}
+
+// checkReferences checks that all the root data referenced exists
+func (l *linter) checkReferences(fn string, doc lintDoc, t *template.Template) []LintFinding {
+	var findings []LintFinding
+	severity := LintSeverityError
+	if allowMissingVariables {
+		severity = LintSeverityWarning
+	}
+	for _, ref := range templateReferences(t.Tree.Root) {
+		l.used[strings.Join(ref.Path, ".")] = true
+		if dataHasPath(l.conf, ref.Path) {
+			continue
+		}
+		findings = append(findings, LintFinding{
+			File:     fn,
+			Line:     doc.Line + strings.Count(doc.Content[:ref.Pos], "\n"),
+			Severity: severity,
+			Rule:     "undefined-variable",
+			Message: fmt.Sprintf(
+				".%s is not set in the config data or environment",
+				strings.Join(ref.Path, ".")),
+		})
+	}
+	return findings
+}
+
+// checkRendered renders a template and checks the resulting yaml is valid
+func (l *linter) checkRendered(fn string, doc lintDoc) []LintFinding {
+	rendered, _, err := Render(l.k8api, doc.Content, l.conf)
+	if err != nil {
+		// Missing variables are reported by checkReferences
+		if strings.Contains(err.Error(), "map has no entry for key") {
+			return nil
+		}
+		return []LintFinding{{
+			File:     fn,
+			Line:     doc.Line,
+			Severity: LintSeverityError,
+			Rule:     "render",
+			Message:  redact(err.Error()),
+		}}
+	}
+	var findings []LintFinding
+	for _, d := range splitYamlDocs(rendered) {
+		var v interface{}
+		if err := yaml.Unmarshal([]byte(d), &v); err != nil {
+			line := doc.Line
+			if m := yamlErrorLine.FindStringSubmatch(err.Error()); m != nil {
+				n, _ := strconv.Atoi(m[1])
+				line += n - 1
+			}
+			findings = append(findings, LintFinding{
+				File:     fn,
+				Line:     line,
+				Severity: LintSeverityError,
+				Rule:     "yaml-syntax",
+				Message:  fmt.Sprintf("rendered yaml is invalid: %s", err),
+			})
+		}
+	}
+	return findings
+}
+
+// unusedConfigData reports config data (not environment) never referenced
+func (l *linter) unusedConfigData() []LintFinding {
+	env := EnvToMap()
+	root, _ := toStringMap(l.conf)
+	var paths []string
+	for k, v := range root {
+		if _, isEnv := env[k]; isEnv || k == EnvScope {
+			continue
+		}
+		paths = append(paths, leafPaths(k, v)...)
+	}
+	sort.Strings(paths)
+	var findings []LintFinding
+	for _, p := range paths {
+		if l.isUsed(p) {
+			continue
+		}
+		findings = append(findings, LintFinding{
+			Severity: LintSeverityWarning,
+			Rule:     "unused-config-data",
+			Message:  fmt.Sprintf(".%s is set in the config data but not used by any template", p),
+		})
+	}
+	return findings
+}
+
+// isUsed reports if a config data path or any parent or child was referenced
+func (l *linter) isUsed(path string) bool {
+	for used := range l.used {
+		if used == path || strings.HasPrefix(path, used+".") || strings.HasPrefix(used, path+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// leafPaths lists the dotted paths of all the values in nested maps
+func leafPaths(prefix string, v interface{}) []string {
+	m, ok := toStringMap(v)
+	if !ok || len(m) == 0 {
+		return []string{prefix}
+	}
+	var paths []string
+	for k, nested := range m {
+		paths = append(paths, leafPaths(prefix+"."+k, nested)...)
+	}
+	return paths
+}
+
+// templateReference is a reference to the root data e.g. .Values.image
+type templateReference struct {
+	Pos  int
+	Path []string
+}
+
+// templateReferences finds all the references to the root data in a template
+func templateReferences(root *parse.ListNode) []templateReference {
+	var refs []templateReference
+	var walk func(node parse.Node, rootScope bool)
+	walk = func(node parse.Node, rootScope bool) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(child, rootScope)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe, rootScope)
+		case *parse.IfNode:
+			walk(n.Pipe, rootScope)
+			walk(n.List, rootScope)
+			walk(n.ElseList, rootScope)
+		case *parse.RangeNode:
+			// The dot is changed within the body of a range or with
+			walk(n.Pipe, rootScope)
+			walk(n.List, false)
+			walk(n.ElseList, rootScope)
+		case *parse.WithNode:
+			walk(n.Pipe, rootScope)
+			walk(n.List, false)
+			walk(n.ElseList, rootScope)
+		case *parse.TemplateNode:
+			walk(n.Pipe, rootScope)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd, rootScope)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg, rootScope)
+			}
+		case *parse.FieldNode:
+			if rootScope {
+				refs = append(refs, templateReference{Pos: int(n.Pos), Path: n.Ident})
+			}
+		case *parse.VariableNode:
+			// $ is always the root data
+			if len(n.Ident) > 1 && n.Ident[0] == "$" {
+				refs = append(refs, templateReference{Pos: int(n.Pos), Path: n.Ident[1:]})
+			}
+		}
+	}
+	walk(root, true)
+	return refs
+}
+
+// dataHasPath reports if a path exists in the data, a path below a value
+// which isn't a map can't be checked so is assumed to exist
+func dataHasPath(data interface{}, path []string) bool {
+	current := data
+	for _, key := range path {
+		m, ok := toStringMap(current)
+		if !ok {
+			if current == nil {
+				return false
+			}
+			return true
+		}
+		if current, ok = m[key]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// splitYamlDocsWithLines splits a yaml string into separate yaml documents
+// recording the line each document starts on
+func splitYamlDocsWithLines(data string) []lintDoc {
+	var docs []lintDoc
+	start := 0
+	add := func(end int) {
+		if content := data[start:end]; len(strings.TrimSpace(content)) > 0 {
+			docs = append(docs, lintDoc{
+				Line:    strings.Count(data[:start], "\n") + 1,
+				Content: content,
+			})
+		}
+	}
+	for _, sep := range yamlDocSeparator.FindAllStringIndex(data, -1) {
+		add(sep[0])
+		start = sep[1]
+	}
+	add(len(data))
+	return docs
+}
+
+// templateFinding creates a finding from a template parse error
+func templateFinding(fn string, line int, err error) LintFinding {
+	f := LintFinding{
+		File:     fn,
+		Line:     line,
+		Severity: LintSeverityError,
+		Rule:     "template-syntax",
+		Message:  err.Error(),
+	}
+	if m := templateError.FindStringSubmatch(err.Error()); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		f.Line = line + n - 1
+		f.Message = m[2]
+	}
+	if strings.HasPrefix(f.Message, "function ") && strings.HasSuffix(f.Message, " not defined") {
+		f.Rule = "undefined-function"
+	}
+	return f
+}
+
+// writeLintFindings writes findings in a format for editors and CI
+func writeLintFindings(w io.Writer, format string, findings []LintFinding) error {
+	if format == LintFormatJSON {
+		if findings == nil {
+			findings = []LintFinding{}
+		}
+		b, err := json.MarshalIndent(findings, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	}
+	for _, f := range findings {
+		location := f.File
+		if f.Line > 0 {
+			location = fmt.Sprintf("%s:%d", f.File, f.Line)
+		}
+		if location == "" {
+			location = "config-data"
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s: [%s] %s\n", location, f.Severity, f.Rule, f.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reportFindings logs the findings of a check made before deploying, any
+// errors fail the check
+func reportFindings(check string, findings []LintFinding) error {
+	var out bytes.Buffer
+	if err := writeLintFindings(&out, LintFormatText, findings); err != nil {
+		return err
+	}
+	errorCount := 0
+	for _, f := range findings {
+		if f.Severity == LintSeverityError {
+			errorCount++
+		}
+	}
+	if errorCount > 0 {
+		logError.Printf("%s failed:\n%s", check, out.String())
+		return fmt.Errorf("%d %s errors found", errorCount, check)
+	}
+	if out.Len() > 0 {
+		logInfo.Printf("%s warnings:\n%s", check, out.String())
+	}
+	return nil
+}
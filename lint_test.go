@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestLintFile(t *testing.T) {
+	values, err := GetConfigData("test/TestLint/values.yaml", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &linter{
+		conf:  map[string]interface{}{"Values": normalizeValue(values)},
+		k8api: NewK8ApiNoop(),
+		used:  map[string]bool{},
+	}
+	got := l.lintFile("resources.yaml", readfile("test/TestLint/resources.yaml"))
+	got = append(got, l.unusedConfigData()...)
+	want := []LintFinding{
+		{
+			File:     "resources.yaml",
+			Line:     7,
+			Severity: LintSeverityError,
+			Rule:     "undefined-variable",
+			Message:  ".Values.nope is not set in the config data or environment",
+		},
+		{
+			File:     "resources.yaml",
+			Line:     14,
+			Severity: LintSeverityError,
+			Rule:     "undefined-function",
+			Message:  `function "undefinedFn" not defined`,
+		},
+		{
+			File:     "resources.yaml",
+			Line:     22,
+			Severity: LintSeverityError,
+			Rule:     "yaml-syntax",
+			Message:  "rendered yaml is invalid: yaml: line 7: did not find expected ',' or ']'",
+		},
+		{
+			Severity: LintSeverityWarning,
+			Rule:     "unused-config-data",
+			Message:  ".Values.image.repository is set in the config data but not used by any template",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %#v\nwant: %#v\n", got, want)
+	}
+}
+
+func TestWriteLintFindings(t *testing.T) {
+	findings := []LintFinding{
+		{File: "a.yaml", Line: 3, Severity: LintSeverityError, Rule: "yaml-syntax", Message: "bad"},
+	}
+	cases := []struct {
+		name   string
+		format string
+		input  []LintFinding
+		want   string
+	}{
+		{
+			name:   "Check text format",
+			format: LintFormatText,
+			input:  findings,
+			want:   "a.yaml:3: error: [yaml-syntax] bad\n",
+		},
+		{
+			name:   "Check json format",
+			format: LintFormatJSON,
+			input:  findings,
+			want:   "[\n  {\n    \"file\": \"a.yaml\",\n    \"line\": 3,\n    \"severity\": \"error\",\n    \"rule\": \"yaml-syntax\",\n    \"message\": \"bad\"\n  }\n]\n",
+		},
+		{
+			name:   "Check json format with no findings",
+			format: LintFormatJSON,
+			want:   "[]\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := writeLintFindings(&b, c.format, c.input); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != c.want {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
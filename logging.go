@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	// FlagLogFormat sets the format of the log output, text or json
+	FlagLogFormat = "log-format"
+	// LogFormatText writes log entries as free text (the default)
+	LogFormatText = "text"
+	// LogFormatJSON writes log entries as one json object per line
+	LogFormatJSON = "json"
+
+	// LogLevelInfo is the level of informational log entries
+	LogLevelInfo = "info"
+	// LogLevelError is the level of error log entries
+	LogLevelError = "error"
+	// LogLevelDebug is the level of debug log entries
+	LogLevelDebug = "debug"
+)
+
+// logFormat is the format the loggers write in
+var logFormat = LogFormatText
+
+// logFields are the structured fields of a log event e.g. action, kind, name,
+// namespace, file, duration and error
+type logFields map[string]interface{}
+
+// newLogger creates a logger for a level writing in the current log format
+func newLogger(w io.Writer, level string) *log.Logger {
+	if logFormat == LogFormatJSON {
+		return log.New(newLogWriter(w, level), "", 0)
+	}
+	return log.New(newLogWriter(w, level), "["+strings.ToUpper(level)+"] ", log.Ldate|log.Ltime|log.Lshortfile)
+}
+
+// newLogWriter creates the writer for a logger in the current log format,
+// entries are always redacted
+func newLogWriter(w io.Writer, level string) io.Writer {
+	if logFormat == LogFormatJSON {
+		return jsonLogWriter{w: w, level: level}
+	}
+	return redactWriter{w}
+}
+
+// setupLogging enables debug logging and sets the log format from the global
+// flags
+func setupLogging(c *cli.Context) error {
+	switch format := c.String(FlagLogFormat); format {
+	case "", LogFormatText:
+		logFormat = LogFormatText
+	case LogFormatJSON:
+		logFormat = LogFormatJSON
+	default:
+		return fmt.Errorf("invalid log format %q, expecting %s or %s", format, LogFormatText, LogFormatJSON)
+	}
+	logInfo = newLogger(os.Stdout, LogLevelInfo)
+	logError = newLogger(os.Stderr, LogLevelError)
+	logDebugIf = newLogger(os.Stderr, LogLevelDebug)
+	if c.Bool("debug") {
+		logDebug = logDebugIf
+	}
+	return nil
+}
+
+// jsonLogWriter writes each log entry as a json object
+type jsonLogWriter struct {
+	w     io.Writer
+	level string
+}
+
+// Write writes a log entry (log.Logger calls Write once per entry) as the
+// message of a json event
+func (jw jsonLogWriter) Write(p []byte) (int, error) {
+	if err := jw.writeEvent(string(p), nil); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeEvent writes a message and its fields as a json object, masking any
+// sensitive values before they are encoded
+func (jw jsonLogWriter) writeEvent(message string, fields logFields) error {
+	event := map[string]interface{}{
+		"time":    time.Now().UTC().Format(time.RFC3339Nano),
+		"level":   jw.level,
+		"message": redact(strings.TrimSpace(message)),
+	}
+	for k, v := range fields {
+		switch value := v.(type) {
+		case string:
+			if value != "" {
+				event[k] = redact(value)
+			}
+		case time.Duration:
+			event[k] = value.Seconds()
+		default:
+			event[k] = value
+		}
+	}
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = jw.w.Write(append(b, '\n'))
+	return err
+}
+
+// logEvent logs a message with structured fields, in text format only the
+// message is written as it already describes the event
+func logEvent(logger *log.Logger, fields logFields, format string, v ...interface{}) {
+	message := fmt.Sprintf(format, v...)
+	if jw, ok := logger.Writer().(jsonLogWriter); ok {
+		if err := jw.writeEvent(message, fields); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		return
+	}
+	logger.Output(2, message)
+}
+
+// resourceFields are the log fields identifying an action on a resource
+func resourceFields(action string, r *ObjectResource) logFields {
+	return logFields{
+		"action":    action,
+		"kind":      r.Kind,
+		"name":      r.Name,
+		"namespace": r.Namespace,
+		"file":      r.FileName,
+	}
+}
+
+// resourceError is an error acting on a resource, logged with the fields of
+// the resource
+type resourceError struct {
+	action   string
+	resource *ObjectResource
+	err      error
+}
+
+func (e *resourceError) Error() string {
+	return e.err.Error()
+}
+
+func (e *resourceError) Unwrap() error {
+	return e.err
+}
+
+// errorFields are the log fields of an error, including the resource it
+// occurred on if known
+func errorFields(err error) logFields {
+	fields := logFields{}
+	var re *resourceError
+	if errors.As(err, &re) {
+		fields = resourceFields(re.action, re.resource)
+	}
+	fields["error"] = err.Error()
+	return fields
+}
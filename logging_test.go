@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+func TestLogEventJSON(t *testing.T) {
+	sensitiveValues.Add("logs3cr3t")
+	defer func() { logFormat = LogFormatText }()
+	logFormat = LogFormatJSON
+
+	r := &ObjectResource{
+		Kind:       "Deployment",
+		ObjectMeta: ObjectMeta{Name: "app", Namespace: "dev"},
+		FileName:   "deploy.yaml",
+	}
+	cases := []struct {
+		name string
+		log  func(l *log.Logger)
+		want map[string]interface{}
+	}{
+		{
+			name: "Check plain entries are written as a message",
+			log:  func(l *log.Logger) { l.Printf("loaded %d files\n", 2) },
+			want: map[string]interface{}{"level": "info", "message": "loaded 2 files"},
+		},
+		{
+			name: "Check resource fields are written",
+			log: func(l *log.Logger) {
+				fields := resourceFields("apply", r)
+				fields["duration"] = 1500 * time.Millisecond
+				logEvent(l, fields, "deploying deployment/app")
+			},
+			want: map[string]interface{}{
+				"level":     "info",
+				"message":   "deploying deployment/app",
+				"action":    "apply",
+				"kind":      "Deployment",
+				"name":      "app",
+				"namespace": "dev",
+				"file":      "deploy.yaml",
+				"duration":  1.5,
+			},
+		},
+		{
+			name: "Check empty fields are omitted",
+			log:  func(l *log.Logger) { logEvent(l, logFields{"action": "skip", "namespace": ""}, "skipped") },
+			want: map[string]interface{}{"level": "info", "message": "skipped", "action": "skip"},
+		},
+		{
+			name: "Check errors include the resource",
+			log: func(l *log.Logger) {
+				err := &resourceError{action: "deploy", resource: r, err: errors.New("kubectl failed")}
+				logEvent(l, errorFields(err), "%s", err)
+			},
+			want: map[string]interface{}{
+				"level":     "info",
+				"message":   "kubectl failed",
+				"action":    "deploy",
+				"kind":      "Deployment",
+				"name":      "app",
+				"namespace": "dev",
+				"file":      "deploy.yaml",
+				"error":     "kubectl failed",
+			},
+		},
+		{
+			name: "Check sensitive values are masked",
+			log:  func(l *log.Logger) { logEvent(l, logFields{"error": "bad token logs3cr3t"}, "token logs3cr3t") },
+			want: map[string]interface{}{"level": "info", "message": "token ***", "error": "bad token ***"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var out bytes.Buffer
+			c.log(newLogger(&out, LogLevelInfo))
+			if strings.Count(out.String(), "\n") != 1 {
+				t.Fatalf("expected a single line, got: %q", out.String())
+			}
+			got := map[string]interface{}{}
+			if err := json.Unmarshal(out.Bytes(), &got); err != nil {
+				t.Fatalf("invalid json %q: %s", out.String(), err)
+			}
+			if _, err := time.Parse(time.RFC3339Nano, fmt.Sprintf("%v", got["time"])); err != nil {
+				t.Errorf("invalid time: %v", got["time"])
+			}
+			delete(got, "time")
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLogEventText(t *testing.T) {
+	var out bytes.Buffer
+	logEvent(newLogger(&out, LogLevelInfo), logFields{"action": "skip"}, "skipping %s", "deployment/app")
+	if !strings.HasPrefix(out.String(), "[INFO] ") || !strings.Contains(out.String(), "logging_test.go") ||
+		!strings.HasSuffix(out.String(), "skipping deployment/app\n") {
+		t.Errorf("unexpected text log entry: %q", out.String())
+	}
+}
+
+func TestSetupLogging(t *testing.T) {
+	defer func() {
+		logFormat = LogFormatText
+		logInfo = newLogger(os.Stdout, LogLevelInfo)
+		logError = newLogger(os.Stderr, LogLevelError)
+		logDebugIf = newLogger(os.Stderr, LogLevelDebug)
+	}()
+	flags := []cli.Flag{cli.StringFlag{Name: FlagLogFormat}, cli.BoolFlag{Name: "debug"}}
+	if err := setupLogging(newTestContext(flags, []string{"--" + FlagLogFormat, "xml"})); err == nil {
+		t.Error("expected an error for an invalid log format")
+	}
+	if err := setupLogging(newTestContext(flags, []string{"--" + FlagLogFormat, LogFormatJSON})); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := logInfo.Writer().(jsonLogWriter); !ok || logInfo.Flags() != 0 || logInfo.Prefix() != "" {
+		t.Errorf("expected a json logger, got writer %T flags %d prefix %q", logInfo.Writer(), logInfo.Flags(), logInfo.Prefix())
+	}
+}
@@ -10,7 +10,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"reflect"
 	"regexp"
 	"strings"
 	"time"
@@ -54,6 +53,48 @@ const (
 	FlagAllowMissing = "allow-missing"
 	// FlagKubeBinary sets the location of the kubectl binary
 	FlagKubeBinary = "kubectl-binary"
+	// FlagConfigDataListMerge sets how lists are merged when layering config data
+	FlagConfigDataListMerge = "config-data-list-merge"
+	// FlagShowConfig prints the final merged config data and exits
+	FlagShowConfig = "show-config"
+	// FlagSet overrides config data values e.g. a.b[0].c=value
+	FlagSet = "set"
+	// FlagSetString overrides config data values, always as strings
+	FlagSetString = "set-string"
+	// FlagSetFile overrides config data values with the content of files
+	FlagSetFile = "set-file"
+	// FlagTypedEnv exposes environment variables as booleans, integers or JSON where they parse
+	FlagTypedEnv = "typed-env"
+	// EnvScope is the config data key for all environment variables
+	EnvScope = "Env"
+	// FlagLookupFixtures sets yaml files of objects to serve k8lookup functions from in a dry run
+	FlagLookupFixtures = "lookup-fixtures"
+	// FlagRequireChecksum requires remote files to be pinned with a checksum
+	FlagRequireChecksum = "require-checksum"
+	// FlagInclude only includes files matching glob patterns when walking directories
+	FlagInclude = "include"
+	// FlagExclude excludes files matching glob patterns when walking directories
+	FlagExclude = "exclude"
+	// FlagOnly only deploys the rendered resources specified as kind/name
+	FlagOnly = "only"
+	// FlagSkip skips the rendered resources specified as kind/name
+	FlagSkip = "skip"
+	// FlagSelector only deploys or deletes the rendered resources with matching labels
+	FlagSelector = "selector"
+	// FlagKustomize builds kustomization directories as a source of resources
+	FlagKustomize = "kustomize"
+	// FlagKustomizeTemplate renders the resources built by kustomize as templates
+	FlagKustomizeTemplate = "kustomize-template"
+	// FlagChart renders a helm chart directory as a source of resources
+	FlagChart = "chart"
+	// FlagChartValues are values files overriding the chart values.yaml
+	FlagChartValues = "chart-values"
+	// FlagReleaseName is the .Release.Name when rendering a chart
+	FlagReleaseName = "release-name"
+	// FlagKubeVersion is the .Capabilities.KubeVersion when rendering a chart
+	FlagKubeVersion = "kube-version"
+	// FlagRedactEnv sets the environment variable name patterns whose values are masked in output
+	FlagRedactEnv = "redact-env"
 )
 
 var (
@@ -85,9 +126,9 @@ var (
 )
 
 func init() {
-	logInfo = log.New(os.Stdout, "[INFO] ", log.Ldate|log.Ltime|log.Lshortfile)
-	logError = log.New(os.Stderr, "[ERROR] ", log.Ldate|log.Ltime|log.Lshortfile)
-	logDebugIf = log.New(os.Stderr, "[DEBUG] ", log.Ldate|log.Ltime|log.Lshortfile)
+	logInfo = newLogger(os.Stdout, LogLevelInfo)
+	logError = newLogger(os.Stderr, LogLevelError)
+	logDebugIf = newLogger(os.Stderr, LogLevelDebug)
 	logDebug = log.New(ioutil.Discard, "", log.Lshortfile)
 }
 
@@ -162,10 +203,43 @@ func main() {
 		},
 		cli.StringSliceFlag{
 			Name:   FlagConfigData,
-			Usage:  "Config data e.g. '--config-data Chart=./Chart.yaml' or '--config-data ./data.yaml'",
+			Usage:  "Config data e.g. '--config-data Chart=./Chart.yaml' or '--config-data ./data.yaml' (later files are merged over earlier files)",
 			EnvVar: "KD_CONFIG_DATA,PLUGIN_KD_CONFIG_DATA",
 			Value:  nil,
 		},
+		cli.StringFlag{
+			Name:   FlagConfigDataListMerge,
+			Usage:  "how lists in later config data are merged, either 'replace' or 'append'",
+			EnvVar: "KD_CONFIG_DATA_LIST_MERGE,PLUGIN_KD_CONFIG_DATA_LIST_MERGE",
+			Value:  ListMergeReplace,
+		},
+		cli.StringSliceFlag{
+			Name:   FlagSet,
+			Usage:  "set config data values on top of any config data e.g. '--set image.tag=v1.2.3' or '--set hosts[0]=a.example.com'",
+			EnvVar: "KD_SET,PLUGIN_KD_SET",
+			Value:  nil,
+		},
+		cli.StringSliceFlag{
+			Name:   FlagSetString,
+			Usage:  "set STRING config data values on top of any config data e.g. '--set-string image.tag=1234'",
+			EnvVar: "KD_SET_STRING,PLUGIN_KD_SET_STRING",
+			Value:  nil,
+		},
+		cli.StringSliceFlag{
+			Name:   FlagSetFile,
+			Usage:  "set config data values from files on top of any config data e.g. '--set-file config.script=./script.sh'",
+			EnvVar: "KD_SET_FILE,PLUGIN_KD_SET_FILE",
+			Value:  nil,
+		},
+		cli.BoolFlag{
+			Name:   FlagTypedEnv,
+			Usage:  "expose environment variables that parse as booleans, integers or JSON with those types in templates",
+			EnvVar: "KD_TYPED_ENV,PLUGIN_KD_TYPED_ENV",
+		},
+		cli.BoolFlag{
+			Name:  FlagShowConfig,
+			Usage: "print the final merged config data and exit",
+		},
 		cli.BoolFlag{
 			Name:   FlagPreRenderTemplates,
 			Usage:  "prerender resources (will prevent automatic create only when secret set).",
@@ -220,9 +294,119 @@ func main() {
 		},
 		cli.StringSliceFlag{
 			Name:   "file, f",
-			Usage:  "the path to a file or directory containing kubernetes resources `PATH`",
+			Usage:  "the path to a file or directory containing kubernetes resources, '-' for stdin or a http(s) URL `PATH`",
 			EnvVar: "FILES,PLUGIN_FILES",
 		},
+		cli.StringSliceFlag{
+			Name:   FlagKustomize + ", k",
+			Usage:  "the path to a kustomization directory to build resources from `DIR`",
+			EnvVar: "KD_KUSTOMIZE,PLUGIN_KD_KUSTOMIZE",
+		},
+		cli.BoolFlag{
+			Name:   FlagKustomizeTemplate,
+			Usage:  "render the resources built from kustomizations as templates",
+			EnvVar: "KD_KUSTOMIZE_TEMPLATE,PLUGIN_KD_KUSTOMIZE_TEMPLATE",
+		},
+		cli.StringFlag{
+			Name:   FlagChart,
+			Usage:  "the path to a helm chart directory to render resources from `DIR`",
+			EnvVar: "KD_CHART,PLUGIN_KD_CHART",
+		},
+		cli.StringSliceFlag{
+			Name:   FlagChartValues,
+			Usage:  "a values file overriding the chart values.yaml, later files take precedence `FILE`",
+			EnvVar: "KD_CHART_VALUES,PLUGIN_KD_CHART_VALUES",
+		},
+		cli.StringFlag{
+			Name:   FlagReleaseName,
+			Usage:  "the release name used when rendering a chart, defaults to the chart name",
+			EnvVar: "KD_RELEASE_NAME,PLUGIN_KD_RELEASE_NAME",
+		},
+		cli.StringFlag{
+			Name:   FlagKubeVersion,
+			Usage:  "the target kubernetes version e.g. 1.35, used for .Capabilities when rendering a chart and the schemas used by --validate",
+			EnvVar: "KD_KUBE_VERSION,PLUGIN_KD_KUBE_VERSION",
+		},
+		cli.StringFlag{
+			Name:   FlagNamespaceMode,
+			Usage:  "reject (the default) or rewrite resources with a namespace other than --namespace",
+			EnvVar: "KD_NAMESPACE_MODE,PLUGIN_KD_NAMESPACE_MODE",
+			Value:  NamespaceModeReject,
+		},
+		cli.StringSliceFlag{
+			Name:   FlagAllowedNamespace,
+			Usage:  "only allow resources to be deployed to the namespaces specified `NAMESPACE`",
+			EnvVar: "KD_ALLOWED_NAMESPACE,PLUGIN_KD_ALLOWED_NAMESPACE",
+		},
+		cli.BoolFlag{
+			Name:   FlagInjectNamespace,
+			Usage:  "set metadata.namespace to --namespace on all namespaced resources so the rendered output is complete",
+			EnvVar: "KD_INJECT_NAMESPACE,PLUGIN_KD_INJECT_NAMESPACE",
+		},
+		cli.BoolFlag{
+			Name:   FlagValidate,
+			Usage:  "validate the rendered resources against the kubernetes schemas for --kube-version before deploying",
+			EnvVar: "KD_VALIDATE,PLUGIN_KD_VALIDATE",
+		},
+		cli.StringSliceFlag{
+			Name:   FlagSchema,
+			Usage:  "a file or directory of CustomResourceDefinitions used to validate custom resources `PATH`",
+			EnvVar: "KD_SCHEMA,PLUGIN_KD_SCHEMA",
+		},
+		cli.BoolFlag{
+			Name:   FlagPolicy,
+			Usage:  "check the rendered resources against the built-in policy rules before deploying",
+			EnvVar: "KD_POLICY,PLUGIN_KD_POLICY",
+		},
+		cli.StringFlag{
+			Name:   FlagPolicyConfig,
+			Usage:  "a yaml file setting the policy rule severities and required labels `FILE`",
+			EnvVar: "KD_POLICY_CONFIG,PLUGIN_KD_POLICY_CONFIG",
+		},
+		cli.StringSliceFlag{
+			Name:   FlagPolicyRule,
+			Usage:  "set the severity of a policy rule e.g. probes=fail, latest-tag=warn or privileged=off",
+			EnvVar: "KD_POLICY_RULE,PLUGIN_KD_POLICY_RULE",
+		},
+		cli.StringSliceFlag{
+			Name:   FlagPolicyDir,
+			Usage:  "a file or directory of user defined CEL policies to check the rendered resources against `PATH`",
+			EnvVar: "KD_POLICY_DIR,PLUGIN_KD_POLICY_DIR",
+		},
+		cli.StringSliceFlag{
+			Name:   FlagInclude,
+			Usage:  "only include files matching a glob pattern when walking directories e.g. 'app/**' or '*-deployment.yaml'",
+			EnvVar: "KD_INCLUDE,PLUGIN_KD_INCLUDE",
+			Value:  nil,
+		},
+		cli.StringSliceFlag{
+			Name:   FlagExclude,
+			Usage:  "exclude files or directories matching a glob pattern when walking directories e.g. 'test/' or '*-dev.yaml'",
+			EnvVar: "KD_EXCLUDE,PLUGIN_KD_EXCLUDE",
+			Value:  nil,
+		},
+		cli.StringFlag{
+			Name:   FlagSelector + ", l",
+			Usage:  "only deploy or delete the rendered resources with labels matching a selector e.g. 'app=foo,tier!=db'",
+			EnvVar: "KD_SELECTOR,PLUGIN_KD_SELECTOR",
+		},
+		cli.StringSliceFlag{
+			Name:   FlagOnly,
+			Usage:  "only deploy the rendered resources specified e.g. 'deployment/app' or 'configmap/app-*'",
+			EnvVar: "KD_ONLY,PLUGIN_KD_ONLY",
+			Value:  nil,
+		},
+		cli.StringSliceFlag{
+			Name:   FlagSkip,
+			Usage:  "skip the rendered resources specified e.g. 'job/migrate' or 'secret/*'",
+			EnvVar: "KD_SKIP,PLUGIN_KD_SKIP",
+			Value:  nil,
+		},
+		cli.BoolFlag{
+			Name:   FlagRequireChecksum,
+			Usage:  "if true, remote files must be pinned with a checksum e.g. '--file https://host/app.yaml#sha256=<hex>'",
+			EnvVar: "KD_REQUIRE_CHECKSUM,PLUGIN_KD_REQUIRE_CHECKSUM",
+		},
 		cli.DurationFlag{
 			Name:   "timeout, T",
 			Usage:  "the amount of time to wait for a successful deployment `TIMEOUT`",
@@ -246,6 +430,80 @@ func main() {
 			Value:  "kubectl",
 			EnvVar: "KUBE_BINARY,KUBECTL_BINARY",
 		},
+		cli.StringSliceFlag{
+			Name:   FlagLookupFixtures,
+			Usage:  "the path to a yaml file or directory of kubernetes objects used for k8lookup functions with --dryrun `PATH`",
+			EnvVar: "KD_LOOKUP_FIXTURES,PLUGIN_KD_LOOKUP_FIXTURES",
+			Value:  nil,
+		},
+		cli.StringSliceFlag{
+			Name:   FlagRedactEnv,
+			Usage:  "environment variable name patterns whose values are masked in output e.g. '*_PASSWORD' (default: *PASSWORD*, *TOKEN*, *SECRET*, and *_KEY for values of 8 or more characters which aren't booleans or numbers)",
+			EnvVar: "KD_REDACT_ENV,PLUGIN_KD_REDACT_ENV",
+			Value:  nil,
+		},
+		cli.StringSliceFlag{
+			Name:   FlagReport,
+			Usage:  "write a report of the action taken and rollout result of every resource to `FILE`, as JUnit XML for files ending .xml otherwise JSON",
+			EnvVar: "KD_REPORT,PLUGIN_KD_REPORT",
+			Value:  nil,
+		},
+		cli.StringSliceFlag{
+			Name:   FlagWebhook,
+			Usage:  "send notifications of the start, success and failure of a run to `URL`",
+			EnvVar: "KD_WEBHOOK,PLUGIN_KD_WEBHOOK",
+			Value:  nil,
+		},
+		cli.StringFlag{
+			Name:   FlagWebhookFormat,
+			Usage:  "the webhook payload format, either 'generic' (JSON report), 'slack' or 'teams'",
+			EnvVar: "KD_WEBHOOK_FORMAT,PLUGIN_KD_WEBHOOK_FORMAT",
+			Value:  WebhookFormatGeneric,
+		},
+		cli.StringSliceFlag{
+			Name:   FlagWebhookEvent,
+			Usage:  "only send webhook notifications for these events, start, success or failure (default: all)",
+			EnvVar: "KD_WEBHOOK_EVENT,PLUGIN_KD_WEBHOOK_EVENT",
+			Value:  nil,
+		},
+		cli.DurationFlag{
+			Name:   FlagWebhookTimeout,
+			Usage:  "the timeout of each webhook request",
+			EnvVar: "KD_WEBHOOK_TIMEOUT,PLUGIN_KD_WEBHOOK_TIMEOUT",
+			Value:  10 * time.Second,
+		},
+		cli.IntFlag{
+			Name:   FlagWebhookRetries,
+			Usage:  "the number of times a failed webhook request is retried",
+			EnvVar: "KD_WEBHOOK_RETRIES,PLUGIN_KD_WEBHOOK_RETRIES",
+			Value:  3,
+		},
+		cli.BoolFlag{
+			Name:   FlagRecordEvents,
+			Usage:  "create kubernetes Events when each resource is applied, deployed successfully or fails, shown by kubectl describe",
+			EnvVar: "KD_RECORD_EVENTS,PLUGIN_KD_RECORD_EVENTS",
+		},
+		cli.BoolFlag{
+			Name:   FlagAnnotate,
+			Usage:  "annotate the deployed resources with the deployer and kd version",
+			EnvVar: "KD_ANNOTATE,PLUGIN_KD_ANNOTATE",
+		},
+		cli.StringFlag{
+			Name:   FlagDeployer,
+			Usage:  "who is deploying, recorded by --record-events and --annotate (defaults to the CI user)",
+			EnvVar: "KD_DEPLOYER,PLUGIN_KD_DEPLOYER,DRONE_COMMIT_AUTHOR,GITHUB_ACTOR,GITLAB_USER_LOGIN,USER",
+		},
+		cli.StringFlag{
+			Name:   FlagPipelineID,
+			Usage:  "the CI pipeline deploying, recorded by --record-events",
+			EnvVar: "KD_PIPELINE_ID,PLUGIN_KD_PIPELINE_ID,DRONE_BUILD_NUMBER,GITHUB_RUN_ID,CI_PIPELINE_ID,BUILD_ID",
+		},
+		cli.StringFlag{
+			Name:   FlagLogFormat,
+			Usage:  "the log format, either 'text' or 'json' (one object per event with level, action, kind, name, namespace, file, duration and error fields)",
+			EnvVar: "KD_LOG_FORMAT,PLUGIN_KD_LOG_FORMAT",
+			Value:  LogFormatText,
+		},
 	}
 	app.Commands = []cli.Command{
 		{
@@ -257,11 +515,38 @@ func main() {
 			SkipFlagParsing: true,
 			OnUsageError:    nil,
 		},
+		{
+			Action:      templateResources,
+			Name:        "template",
+			Usage:       "template [--output-dir DIR] - renders resources as yaml without deploying",
+			Description: "renders all the resources specified by the kd global flags exactly as a deployment would and writes them to stdout or one file per resource",
+			UsageText:   "kd --file PATH [global options] template [--output-dir DIR]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  FlagOutputDir + ", o",
+					Usage: "write one file per resource named kind-name.yaml to `DIR` instead of stdout",
+				},
+			},
+		},
+		{
+			Action:      lintTemplates,
+			Name:        "lint",
+			Usage:       "lint [--format text|json] - checks templates without deploying",
+			Description: "checks all templates specified by the kd global flags for undefined functions, undefined and unused config data and invalid yaml",
+			UsageText:   "kd --file PATH [global options] lint [--format text|json]",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "format",
+					Usage: "the output format, either 'text' (file:line: severity: [rule] message) or 'json'",
+					Value: LintFormatText,
+				},
+			},
+		},
 	}
 
 	app.Action = func(cx *cli.Context) error {
 		if err := run(cx); err != nil {
-			logError.Print(err)
+			logEvent(logError, errorFields(err), "%s", err)
 			return cli.NewExitError("", 1)
 		}
 
@@ -278,13 +563,15 @@ func cleanup() {
 	if len(tmpDir) > 0 {
 		logDebug.Printf("cleaning up %s", tmpDir)
 		os.RemoveAll(tmpDir)
+		tmpDir = ""
 	}
 }
 
 func runKubectl(c *cli.Context) error {
-	if c.Parent().Bool("debug") {
-		logDebug = logDebugIf
+	if err := setupLogging(c.Parent()); err != nil {
+		return err
 	}
+	setupRedaction(c.Parent())
 	if c.Parent().IsSet(FlagCreateOnlyResources) {
 		if len(c.Parent().StringSlice(FlagCreateOnlyResources)) > 1 {
 			return fmt.Errorf("can only specify a single resource when using run")
@@ -308,7 +595,7 @@ func runKubectl(c *cli.Context) error {
 				"problem checking if resource %s/%s exists", name, kind)
 		}
 		if exists {
-			log.Printf(
+			logEvent(logInfo, logFields{"action": "skip", "kind": kind, "name": name},
 				"resource marked as 'create only', skipping app for %s", resString)
 			return nil
 		}
@@ -319,7 +606,7 @@ func runKubectl(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
-	logDebug.Printf("About to run %s", cmd.Args)
+	logDebug.Printf("About to run %s", redactArgs(cmd.Args))
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -334,12 +621,17 @@ func runKubectl(c *cli.Context) error {
 }
 
 func run(c *cli.Context) error {
-	if c.Bool("debug") {
-		logDebug = logDebugIf
+	if err := setupLogging(c); err != nil {
+		return err
 	}
-	// Check we have some files to process
-	if len(c.StringSlice("file")) == 0 {
-		return errors.New("no kubernetes resource files specified")
+	if c.Bool(FlagShowConfig) {
+		// Keep stdout for the config data only
+		logInfo.SetOutput(newLogWriter(os.Stderr, LogLevelInfo))
+	}
+	setupRedaction(c)
+	// Fail early on invalid webhook flags rather than when notifying
+	if _, err := newWebhooks(c); err != nil {
+		return err
 	}
 
 	// Get config data from env or files
@@ -347,96 +639,312 @@ func run(c *cli.Context) error {
 	if err != nil {
 		return err
 	}
+	if c.Bool(FlagShowConfig) {
+		return showConfig(conf, EnvToData(c.Bool(FlagTypedEnv)))
+	}
+
+	// Check we have some files to process
+	if !hasResourceSources(c) {
+		return errors.New("no kubernetes resource files, kustomizations or chart specified")
+	}
 
 	// Check if all files exist first - fail early on building up a list of files
-	var files []string
-	for _, fn := range c.StringSlice("file") {
-		logDebug.Printf("about to open file:%s\n", fn)
-		stat, err := os.Stat(fn)
-		if err != nil {
-			return err
+	files, err := listFiles(c)
+	if err != nil {
+		return err
+	}
+
+	if c.IsSet(FlagAllowMissing) {
+		allowMissingVariables = true
+	}
+
+	k8api, err := newK8Api(c)
+	if err != nil {
+		return err
+	}
+	started := time.Now()
+	resources, err := renderResources(c, conf, files)
+	if err == nil {
+		notifyWebhooks(c, WebhookEventStart, started, resources, nil)
+		err = deployResources(c, k8api, resources)
+	}
+	if err == nil {
+		notifyWebhooks(c, WebhookEventSuccess, started, resources, nil)
+	} else {
+		notifyWebhooks(c, WebhookEventFailure, started, resources, err)
+	}
+	if reportErr := writeReports(c, started, resources, err); reportErr != nil {
+		if err == nil {
+			return reportErr
 		}
-		switch stat.IsDir() {
-		case true:
-			fileList, err := ListDirectory(fn)
-			if err != nil {
+		logError.Print(reportErr)
+	}
+	return err
+}
+
+// deployResources deploys the resources in order, stopping at the first error
+func deployResources(c *cli.Context, k8api K8Api, resources []*ObjectResource) error {
+	annotations := deployAnnotations(c)
+	for _, r := range resources {
+		// Only perform deploy if dry-run is not set to true
+		if dryRun {
+			r.Result.Action = ActionDryRun
+			continue
+		}
+		if c.Bool(FlagAnnotate) && !c.Bool(FlagDelete) && r.Kind != "" {
+			if err := annotateResource(r, annotations); err != nil {
 				return err
 			}
-			files = append(files, fileList...)
-		default:
-			files = append(files, fn)
+		}
+		if err := deploy(c, k8api, r); err != nil {
+			r.Result.Error = err.Error()
+			if r.Result.Action == "" {
+				r.Result.Action = ActionFailed
+			}
+			action := "deploy"
+			if c.Bool(FlagDelete) {
+				action = "delete"
+			}
+			if !c.Bool(FlagDelete) {
+				recordEvent(c, r, EventReasonFailed, EventTypeWarning, deployMessage(c, "failed to deploy")+": "+err.Error())
+			}
+			return &resourceError{action: action, resource: r, err: err}
+		}
+		if !c.Bool(FlagDelete) && !strings.HasPrefix(r.Result.Action, "skipped") {
+			message := deployMessage(c, "deployed")
+			if r.Result.Rollout == RolloutComplete {
+				message += fmt.Sprintf(", ready after %.1fs", r.Result.TimeToReady.Seconds())
+			}
+			recordEvent(c, r, EventReasonSucceeded, EventTypeNormal, message)
 		}
 	}
+	return nil
+}
 
-	if c.IsSet(FlagAllowMissing) {
-		allowMissingVariables = true
+// renderResources renders all the files to a list of resources - fail early.
+func renderResources(c *cli.Context, conf interface{}, files []string) ([]*ObjectResource, error) {
+	k8api, err := newK8Api(c)
+	if err != nil {
+		return nil, err
 	}
 
-	// Iterate the list of files and add rendered templates to resources list - fail early.
+	// Iterate the list of files and add rendered templates to resources list
 	resources := []*ObjectResource{}
 	for _, fn := range files {
 		logDebug.Printf("parsing file:%s\n", fn)
-		data, err := ioutil.ReadFile(fn)
+		data, err := readResourceFile(fn)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		var k8api K8Api
-		if dryRun {
-			k8api = NewK8ApiNoop()
-		} else {
-			k8api = NewK8ApiKubectl(c)
+		rendered, err := renderFile(c, k8api, conf, fn, string(data), true)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, rendered...)
+	}
+	// Add the resources built from any kustomizations
+	for _, dir := range c.StringSlice(FlagKustomize) {
+		data, err := buildKustomization(dir)
+		if err != nil {
+			return nil, err
+		}
+		built, err := renderFile(c, k8api, conf, dir, data, c.Bool(FlagKustomizeTemplate))
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, built...)
+	}
+	// Add the resources rendered from any chart
+	if dir := c.String(FlagChart); dir != "" {
+		manifests, err := renderChart(c, dir)
+		if err != nil {
+			return nil, err
 		}
-		var preRendered string
-		if c.IsSet(FlagPreRenderTemplates) {
-			preRendered, _, err = Render(k8api, string(data), conf)
+		for _, m := range manifests {
+			rendered, err := renderFile(c, k8api, conf, m.Name, m.Content, false)
 			if err != nil {
-				return err
+				return nil, err
 			}
-		} else {
-			preRendered = string(data)
+			resources = append(resources, rendered...)
 		}
-		for _, d := range splitYamlDocs(preRendered) {
-			rendered, genSecret, err := Render(k8api, string(d), conf)
+	}
+	// Type errors are reported per file by --validate when it is set
+	var typeErr error
+	for _, r := range resources {
+		// Always register secret values so they are masked in any kubectl errors
+		masked := redactTemplate(r.Template)
+		if c.Bool("debug-templates") {
+			logInfo.Printf("Template:\n%s", masked)
+		}
+		if err := yaml.Unmarshal(r.Template, &r); err != nil {
+			// The rest of a resource is still decoded after a type error
+			_, isTypeErr := err.(*yaml.TypeError)
+			err = fmt.Errorf("error parsing %s/%s (from file:%q):%s", strings.ToLower(r.Kind), r.Name, r.FileName, err)
+			if !isTypeErr || !c.Bool(FlagValidate) {
+				return nil, err
+			}
+			if typeErr == nil {
+				typeErr = err
+			}
+		}
+		// Add any flag specific settings for resources
+		updateResFromFlags(c, r)
+	}
+	only, err := ParseResourceSelectors(c.StringSlice(FlagOnly))
+	if err != nil {
+		return nil, err
+	}
+	skip, err := ParseResourceSelectors(c.StringSlice(FlagSkip))
+	if err != nil {
+		return nil, err
+	}
+	selector, err := ParseLabelSelector(c.String(FlagSelector))
+	if err != nil {
+		return nil, err
+	}
+	resources = filterResourcesByLabels(resources, selector)
+	resources = filterResources(resources, only, skip)
+	// Classify kinds the same way whether deploying or templating
+	if !dryRun {
+		discoverClusterScopedKinds(c)
+	}
+	if err := enforceNamespaces(c, resources); err != nil {
+		return nil, err
+	}
+	if err := checkConflicts(c, resources); err != nil {
+		return nil, err
+	}
+	if c.Bool(FlagValidate) {
+		if err := validateResources(c, resources); err != nil {
+			return nil, err
+		}
+	}
+	if typeErr != nil {
+		return nil, typeErr
+	}
+	if policyEnabled(c) {
+		if err := checkPolicies(c, conf, resources); err != nil {
+			return nil, err
+		}
+	}
+	return resources, nil
+}
+
+// renderFile splits the data from a file into resources, rendering each
+// document as a template unless told otherwise
+func renderFile(c *cli.Context, k8api K8Api, conf interface{}, fn, data string, render bool) ([]*ObjectResource, error) {
+	var err error
+	preRendered := data
+	if render && c.IsSet(FlagPreRenderTemplates) {
+		preRendered, _, err = Render(k8api, data, conf)
+		if err != nil {
+			return nil, err
+		}
+	}
+	resources := []*ObjectResource{}
+	for _, d := range splitYamlDocs(preRendered) {
+		rendered, genSecret := d, false
+		if render {
+			rendered, genSecret, err = Render(k8api, d, conf)
 			if err != nil {
-				return err
+				return nil, err
 			}
+		}
+		items, err := splitListItems(rendered)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing resources in file '%s':%s", fn, err)
+		}
+		for _, item := range items {
 			r := &ObjectResource{
 				FileName:   fn,
-				Template:   []byte(rendered),
+				Template:   []byte(item),
 				CreateOnly: genSecret,
 			}
 			resources = append(resources, r)
 		}
 	}
-	for _, r := range resources {
-		if c.Bool("debug-templates") {
-			logInfo.Printf("Template:\n" + string(r.Template[:]))
+	return resources, nil
+}
+
+// listFiles builds a list of all the files specified by the file flag
+func listFiles(c *cli.Context) ([]string, error) {
+	filter, err := NewFileFilter(c.StringSlice(FlagInclude), c.StringSlice(FlagExclude))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	stdin := false
+	for _, fn := range c.StringSlice("file") {
+		logDebug.Printf("about to open file:%s\n", fn)
+		switch {
+		case fn == StdinFile:
+			if stdin {
+				return nil, errors.New("stdin can only be specified as a file once")
+			}
+			stdin = true
+			files = append(files, fn)
+			continue
+		case isRemoteFile(fn):
+			if c.Bool(FlagRequireChecksum) && !hasChecksum(fn) {
+				return nil, fmt.Errorf(
+					"remote file %s must be pinned with a checksum e.g. %s#sha256=<hex>", fn, fn)
+			}
+			files = append(files, fn)
+			continue
 		}
-		if err := yaml.Unmarshal(r.Template, &r); err != nil {
-			return err
+		stat, err := os.Stat(fn)
+		if err != nil {
+			return nil, err
 		}
-		// Add any flag specific settings for resources
-		updateResFromFlags(c, r)
-
-		// Only perform deploy if dry-run is not set to true
-		if !dryRun {
-			if err := deploy(c, r); err != nil {
-				return err
+		switch stat.IsDir() {
+		case true:
+			fileList, err := ListDirectoryFiltered(fn, filter)
+			if err != nil {
+				return nil, err
 			}
+			files = append(files, fileList...)
+		default:
+			files = append(files, fn)
 		}
 	}
-	return nil
+	return files, nil
 }
 
-// GetAnyConfigData get config data from env or files
+// newK8Api creates the K8Api used for template lookups
+func newK8Api(c *cli.Context) (K8Api, error) {
+	if c.IsSet(FlagLookupFixtures) && !dryRun {
+		return nil, fmt.Errorf("--%s can only be used with --dryrun", FlagLookupFixtures)
+	}
+	if dryRun {
+		return newOfflineK8Api(c)
+	}
+	return NewK8ApiKubectl(c), nil
+}
+
+// newOfflineK8Api creates a K8Api for template lookups which never connects
+// to a server
+func newOfflineK8Api(c *cli.Context) (K8Api, error) {
+	if c.IsSet(FlagLookupFixtures) {
+		return NewK8ApiFixtures(c.StringSlice(FlagLookupFixtures), c.String("namespace"))
+	}
+	return NewK8ApiNoop(), nil
+}
+
+// GetAnyConfigData get config data from env or files. Data is layered in
+// order; the environment, then each --config-data file with later files
+// deep merged over earlier ones and finally any --set values.
 func GetAnyConfigData(c *cli.Context) (interface{}, error) {
-	// Make a map we can use:
-	confMap := make(map[string]interface{})
-	var conf interface{}
+	listPolicy := c.String(FlagConfigDataListMerge)
+	switch listPolicy {
+	case "":
+		listPolicy = ListMergeReplace
+	case ListMergeReplace, ListMergeAppend:
+	default:
+		return nil, fmt.Errorf(
+			"invalid %s value %q, expecting %s or %s",
+			FlagConfigDataListMerge, listPolicy, ListMergeReplace, ListMergeAppend)
+	}
 	if c.IsSet("config") {
-		if c.IsSet(FlagConfigData) {
-			return nil, fmt.Errorf("cannot set %s if --config flag is set", FlagConfigData)
-		}
 		// Load Environment file overrides into the OS Environment Scope
 		err := godotenv.Load(c.String("config"))
 		if err != nil {
@@ -444,45 +952,56 @@ func GetAnyConfigData(c *cli.Context) (interface{}, error) {
 		}
 		// Now get any environment data (as set from above)
 	}
-	// Copy environment to new untyped map:
-	for k, v := range EnvToMap() {
-		confMap[k] = v
-	}
+	// Make a map we can use, starting with a copy of the environment
+	confMap := EnvToData(c.Bool(FlagTypedEnv))
 	for _, cd := range c.StringSlice(FlagConfigData) {
 		// Support flag sytax --flag scope=file.yaml or --flag file.yaml
 		fields := strings.Split(cd, "=")
 		switch len(fields) {
 		case 1:
-			if len(c.StringSlice(FlagConfigData)) > 1 {
-				return nil, fmt.Errorf(
-					"only support a single unscoped %s or multiple scoped entries",
-					FlagConfigData)
-			}
-			var err error
 			// --flag file.yaml
-			conf, err = GetConfigData(fields[0], true)
+			conf, err := GetConfigData(fields[0], false)
 			if err != nil {
 				return nil, err
 			}
-			// Only support a single top scoped data item today
-			return conf, nil
+			if conf == nil {
+				continue
+			}
+			confTyped, ok := toStringMap(conf)
+			if !ok {
+				return nil, fmt.Errorf(
+					"config data file '%s' must contain a map when not scoped", fields[0])
+			}
+			confMap = mergeValues(confMap, confTyped, listPolicy)
 		case 2:
 			// --flag scope=file.yaml
 			scopedConf, err := GetConfigData(fields[1], false)
 			if err != nil {
 				return nil, err
 			}
-			// Update the scoped data:
-			confMap[fields[0]] = scopedConf
+			// Merge or update the scoped data:
+			confMap = mergeValues(
+				confMap,
+				map[string]interface{}{fields[0]: normalizeValue(scopedConf)},
+				listPolicy)
 		default:
 			return nil, fmt.Errorf(
 				"%s flag cannot be parsed; data.yaml or scope=data.yaml expected",
 				cd)
 		}
 	}
-	// Cast the typed map to generic interface
-	conf = confMap
-	return conf, nil
+	// The environment is also available at .Env so it can't collide with
+	// config data keys, unless the config data defines its own Env scope
+	if _, found := confMap[EnvScope]; found {
+		logDebug.Printf("config data defines %s, the environment is only available at the top level", EnvScope)
+	} else {
+		confMap[EnvScope] = EnvToData(c.Bool(FlagTypedEnv))
+	}
+	// Lastly, apply any values set on the command line
+	if err := setValues(c, confMap); err != nil {
+		return nil, err
+	}
+	return confMap, nil
 }
 
 // GetConfigData gets data from a file
@@ -505,13 +1024,13 @@ func GetConfigData(f string, mergeEnv bool) (interface{}, error) {
 			err)
 	}
 
-	// Load yaml
-	if err := yaml.Unmarshal([]byte(rendered), &conf); err != nil {
-		return nil, err
+	// Load data using the parser for the file extension
+	conf, err = parseConfigData(f, []byte(rendered))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing config data file '%s':%s", f, err)
 	}
 	// Update any values which DON't exist from environment
-	if mergeEnv && reflect.TypeOf(conf).Kind() == reflect.Map {
-		confTyped := conf.(map[interface{}]interface{})
+	if confTyped, ok := toStringMap(conf); mergeEnv && ok {
 		for k, v := range EnvToMap() {
 			if _, ok := confTyped[k]; !ok {
 				// Value NOT found - update map:
@@ -575,7 +1094,32 @@ func splitYamlDocs(data string) []string {
 	return s
 }
 
-func deploy(c *cli.Context, r *ObjectResource) error {
+// splitListItems splits a kind List (or e.g. DeploymentList) document into a
+// document per item, any other document is returned as is
+func splitListItems(data string) ([]string, error) {
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		// Leave any errors to be reported with the resource
+		return []string{data}, nil
+	}
+	kind, _ := doc["kind"].(string)
+	items, isList := doc["items"].([]interface{})
+	if !strings.HasSuffix(kind, "List") || !isList {
+		return []string{data}, nil
+	}
+	docs := make([]string, 0, len(items))
+	for _, item := range items {
+		b, err := yaml.Marshal(item)
+		if err != nil {
+			return nil, err
+		}
+		docs = append(docs, string(b))
+	}
+	logDebug.Printf("expanded %s into %d resources", kind, len(docs))
+	return docs, nil
+}
+
+func deploy(c *cli.Context, k8api K8Api, r *ObjectResource) error {
 
 	exists := false
 	if r.CreateOnly || c.Bool(FlagReplace) || c.Bool(FlagDelete) {
@@ -586,12 +1130,16 @@ func deploy(c *cli.Context, r *ObjectResource) error {
 		}
 
 		if r.CreateOnly && exists {
-			log.Printf("skipping deploy for resource (%s/%s) marked as create only.", r.Kind, r.Name)
+			r.Result.Action = ActionSkippedCreateOnly
+			logEvent(logInfo, resourceFields("skip", r),
+				"skipping deploy for resource (%s/%s) marked as create only.", r.Kind, r.Name)
 			return nil
 		}
 
 		if c.Bool(FlagDelete) && !exists {
-			log.Printf("skipping delete for resource (%s/%s) as it does not exist.", r.Kind, r.Name)
+			r.Result.Action = ActionSkippedNotFound
+			logEvent(logInfo, resourceFields("skip", r),
+				"skipping delete for resource (%s/%s) as it does not exist.", r.Kind, r.Name)
 			return nil
 		}
 	}
@@ -618,6 +1166,19 @@ func deploy(c *cli.Context, r *ObjectResource) error {
 		command = "create"
 	}
 
+	// Changes to immutable fields can't be applied so fail early or recreate
+	if command == "apply" {
+		recreate, err := checkImmutableChanges(k8api, r)
+		if err != nil {
+			return err
+		}
+		if recreate {
+			if err := deleteResource(c, r); err != nil {
+				return err
+			}
+		}
+	}
+
 	logDebug.Printf("%s resource %s/%s (from file:%q)", action, r.Kind, name, r.FileName)
 	args := []string{command, "-f", "-"}
 	cmd, err := newKubeCmd(c, args, true)
@@ -626,7 +1187,7 @@ func deploy(c *cli.Context, r *ObjectResource) error {
 	}
 
 	if c.Bool("debug") {
-		logDebug.Printf("kubectl arguments: %q", strings.Join(cmd.Args, " "))
+		logDebug.Printf("kubectl arguments: %q", redactArgs(cmd.Args))
 	}
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
@@ -642,23 +1203,35 @@ func deploy(c *cli.Context, r *ObjectResource) error {
 		stdin.Write(r.Template)
 	}()
 
-	logInfo.Printf("%s %s/%s", action, strings.ToLower(r.Kind), r.Name)
+	logEvent(logInfo, resourceFields(command, r), "%s %s/%s", action, strings.ToLower(r.Kind), r.Name)
+	start := time.Now()
 	if err = cmd.Run(); err != nil {
 		if errbuf.Len() > 0 {
-			return fmt.Errorf(errbuf.String())
+			return errors.New(redact(errbuf.String()))
 		}
 		return err
 	}
-	logInfo.Print(outbuf.String())
+	fields := resourceFields(command, r)
+	fields["duration"] = time.Since(start)
+	logEvent(logInfo, fields, "%s", outbuf.String())
+	r.Result.Action = kubectlAction(r, outbuf.String(), command)
 
 	if r.GenerateName != "" {
 		//This gets the generated resource name from the output
 		resourceName := strings.TrimSuffix(outbuf.String(), " created\n")
 		r.Name = strings.Split(resourceName, "/")[1]
 	}
+	if command != "delete" {
+		recordEvent(c, r, EventReasonApplied, EventTypeNormal, deployMessage(c, r.Result.Action))
+	}
 
 	if !c.Bool(FlagDelete) && isWatchableResouce(r) && !skipChecks {
-		return watchResource(c, r)
+		if err := watchResource(c, r); err != nil {
+			if r.Result.Rollout == "" {
+				r.Result.Rollout = RolloutFailed
+			}
+			return err
+		}
 	}
 	return nil
 }
@@ -679,6 +1252,7 @@ func watchResource(c *cli.Context, r *ObjectResource) error {
 	if c.Bool("debug") {
 		logDebug.Printf("sleeping %d seconds before checking %s status for the first time", DeployDelaySeconds, r.Kind)
 	}
+	start := time.Now()
 	time.Sleep(DeployDelaySeconds * time.Second)
 
 	if err := updateResourceStatus(c, r); err != nil {
@@ -705,6 +1279,7 @@ func watchResource(c *cli.Context, r *ObjectResource) error {
 	for {
 		select {
 		case <-timeout:
+			r.Result.Rollout = RolloutTimeout
 			return fmt.Errorf("%s rolling update %q timed out after %s", r.Kind, r.Name, c.Duration("timeout").String())
 		case <-ticker.C:
 			r.DeploymentStatus = DeploymentStatus{}
@@ -766,10 +1341,15 @@ func watchResource(c *cli.Context, r *ObjectResource) error {
 			}
 
 			if ready {
-				logInfo.Printf("%s %q is complete. Available objects: %d\n", r.Kind, r.Name, availableResourceCount)
+				r.Result.Rollout = RolloutComplete
+				r.Result.TimeToReady = time.Since(start)
+				fields := resourceFields("rollout", r)
+				fields["duration"] = r.Result.TimeToReady
+				logEvent(logInfo, fields, "%s %q is complete. Available objects: %d\n", r.Kind, r.Name, availableResourceCount)
 				return nil
 			}
-			logInfo.Printf("%s %q update in progress. Waiting for %d objects.\n", r.Kind, r.Name, unavailableResourceCount)
+			logEvent(logInfo, resourceFields("rollout", r),
+				"%s %q update in progress. Waiting for %d objects.\n", r.Kind, r.Name, unavailableResourceCount)
 
 			// Fail the deployment in case another deployment has started
 			if og != r.DeploymentStatus.ObservedGeneration && c.Bool("fail-superseded") {
@@ -818,7 +1398,7 @@ func checkResourceExist(c *cli.Context, r *ObjectResource) (bool, error) {
 		logDebug.Printf(
 			"error with kubectl: %s. kubectl arguments: %q",
 			err,
-			strings.Join(cmd.Args, " "))
+			redactArgs(cmd.Args))
 		errData, _ := ioutil.ReadAll(stderr)
 		if strings.Contains("NotFound", string(errData[:])) {
 			return false, nil
@@ -969,16 +1549,50 @@ func extraFlags(c *cli.Context, subCommand bool) ([]string, error) {
 
 // ListDirectory returns a recursive list of all files under a directory, or an error
 func ListDirectory(path string) ([]string, error) {
+	return ListDirectoryFiltered(path, &FileFilter{})
+}
+
+// ListDirectoryFiltered returns a recursive list of all files under a directory
+// selected by a filter and not ignored by a .kdignore file in any directory
+// above them, or an error
+func ListDirectoryFiltered(root string, filter *FileFilter) ([]string, error) {
+	// The .kdignore patterns of each directory by path relative to root
+	ignores := map[string][]filePattern{}
 	var list []string
-	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-		if !info.IsDir() {
-			// We only support yaml at the moment, so we might well filter on it
-			switch filepath.Ext(path) {
-			case ".yaml":
-				fallthrough
-			case ".yml":
-				list = append(list, path)
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if rel != "." && (isIgnored(ignores, rel, true) ||
+				matchesFilePatterns(filter.Exclude, rel, true)) {
+				logDebug.Printf("skipping directory %s", path)
+				return filepath.SkipDir
+			}
+			ignore, err := readIgnoreFile(path)
+			if err != nil {
+				return err
+			}
+			ignores[rel] = ignore
+			return nil
+		}
+		// We only support yaml and json, so we might well filter on them
+		switch filepath.Ext(path) {
+		case ".yaml", ".yml", ".json":
+			if isIgnored(ignores, rel, false) ||
+				matchesFilePatterns(filter.Exclude, rel, false) {
+				logDebug.Printf("skipping excluded file %s", path)
+				return nil
+			}
+			if len(filter.Include) > 0 && !matchesFilePatterns(filter.Include, rel, false) {
+				logDebug.Printf("skipping file %s not included", path)
+				return nil
 			}
+			list = append(list, path)
 		}
 		return nil
 	})
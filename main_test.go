@@ -1,11 +1,14 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
 	"reflect"
 	"testing"
+
+	"github.com/urfave/cli"
 )
 
 func TestSplitYamlDocs(t *testing.T) {
@@ -46,6 +49,52 @@ func TestSplitYamlDocs(t *testing.T) {
 	}
 }
 
+func TestSplitListItems(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "not a list",
+			input: "kind: ConfigMap\nmetadata:\n  name: foo\n",
+			want:  []string{"kind: ConfigMap\nmetadata:\n  name: foo\n"},
+		},
+		{
+			name:  "yaml list",
+			input: "apiVersion: v1\nkind: List\nitems:\n- kind: ConfigMap\n  metadata:\n    name: foo\n- kind: Service\n  metadata:\n    name: bar\n",
+			want:  []string{"kind: ConfigMap\nmetadata:\n  name: foo\n", "kind: Service\nmetadata:\n  name: bar\n"},
+		},
+		{
+			name:  "json typed list",
+			input: `{"apiVersion": "apps/v1", "kind": "DeploymentList", "items": [{"kind": "Deployment", "metadata": {"name": "foo"}}]}`,
+			want:  []string{"kind: Deployment\nmetadata:\n  name: foo\n"},
+		},
+		{
+			name:  "empty list",
+			input: "kind: List\nitems: []\n",
+			want:  []string{},
+		},
+		{
+			name:  "list kind without items",
+			input: "kind: AllowList\nspec: {}\n",
+			want:  []string{"kind: AllowList\nspec: {}\n"},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := splitListItems(c.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
 func TestListDirectory(t *testing.T) {
 	cases := []struct {
 		name  string
@@ -55,7 +104,7 @@ func TestListDirectory(t *testing.T) {
 		{
 			name:  "Check yaml files exist",
 			input: "test/TestListDirectory/",
-			want:  []string{"test/TestListDirectory/1-resource.yaml", "test/TestListDirectory/2-resource.yaml", "test/TestListDirectory/a.yaml", "test/TestListDirectory/b.yaml", "test/TestListDirectory/empty.yaml"},
+			want:  []string{"test/TestListDirectory/1-resource.yaml", "test/TestListDirectory/2-resource.yaml", "test/TestListDirectory/a.yaml", "test/TestListDirectory/b.yaml", "test/TestListDirectory/c.json", "test/TestListDirectory/empty.yaml"},
 		},
 	}
 
@@ -219,3 +268,245 @@ func TestGetConfigData(t *testing.T) {
 		})
 	}
 }
+
+func TestTypedEnvValue(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		want  interface{}
+	}{
+		{name: "Check integers are typed", input: "3", want: int64(3)},
+		{name: "Check booleans are typed", input: "False", want: false},
+		{name: "Check json objects are typed", input: `{"a": [1, "b"]}`, want: map[string]interface{}{"a": []interface{}{int64(1), "b"}}},
+		{name: "Check versions are left as strings", input: "1.10", want: "1.10"},
+		{name: "Check zero padded numbers are left as strings", input: "007", want: "007"},
+		{name: "Check negative integers are typed", input: "-12", want: int64(-12)},
+		{name: "Check invalid json is left as a string", input: "[not json", want: "[not json"},
+		{name: "Check strings are left as strings", input: "yes", want: "yes"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := typedEnvValue(c.input)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
+// newTestContext creates a cli context with the flags specified parsed from args
+func newTestContext(flags []cli.Flag, args []string) *cli.Context {
+	set := flag.NewFlagSet("kd", flag.ContinueOnError)
+	for _, f := range flags {
+		f.Apply(set)
+	}
+	set.Parse(args)
+	return cli.NewContext(nil, set, nil)
+}
+
+func TestMergeValues(t *testing.T) {
+	cases := []struct {
+		name       string
+		dst        map[string]interface{}
+		src        map[string]interface{}
+		listPolicy string
+		want       map[string]interface{}
+	}{
+		{
+			name:       "Check later values override earlier values",
+			dst:        map[string]interface{}{"a": "one", "b": "two"},
+			src:        map[string]interface{}{"b": "three"},
+			listPolicy: ListMergeReplace,
+			want:       map[string]interface{}{"a": "one", "b": "three"},
+		},
+		{
+			name: "Check nested maps are merged",
+			dst: map[string]interface{}{
+				"image": map[interface{}]interface{}{"repository": "quay.io/sample", "tag": "v1"}},
+			src: map[string]interface{}{
+				"image": map[interface{}]interface{}{"tag": "v2"}},
+			listPolicy: ListMergeReplace,
+			want: map[string]interface{}{
+				"image": map[string]interface{}{"repository": "quay.io/sample", "tag": "v2"}},
+		},
+		{
+			name:       "Check lists are replaced",
+			dst:        map[string]interface{}{"hosts": []interface{}{"a"}},
+			src:        map[string]interface{}{"hosts": []interface{}{"b"}},
+			listPolicy: ListMergeReplace,
+			want:       map[string]interface{}{"hosts": []interface{}{"b"}},
+		},
+		{
+			name:       "Check lists are appended",
+			dst:        map[string]interface{}{"hosts": []interface{}{"a"}},
+			src:        map[string]interface{}{"hosts": []interface{}{"b"}},
+			listPolicy: ListMergeAppend,
+			want:       map[string]interface{}{"hosts": []interface{}{"a", "b"}},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := mergeValues(c.dst, c.src, c.listPolicy)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
+func TestGetAnyConfigData(t *testing.T) {
+	flags := []cli.Flag{
+		cli.StringSliceFlag{Name: FlagConfigData},
+		cli.StringFlag{Name: FlagConfigDataListMerge},
+		cli.StringFlag{Name: "config"},
+		cli.StringSliceFlag{Name: FlagSet},
+		cli.StringSliceFlag{Name: FlagSetString},
+		cli.StringSliceFlag{Name: FlagSetFile},
+		cli.BoolFlag{Name: FlagTypedEnv},
+	}
+	cases := []struct {
+		name string
+		args []string
+		want map[string]interface{}
+	}{
+		{
+			name: "Check unscoped files are layered",
+			args: []string{
+				"--config-data", "./test/TestConfigData/values.yaml",
+				"--config-data", "./test/TestConfigData/values-prod.yaml",
+			},
+			want: map[string]interface{}{
+				"image":    map[string]interface{}{"repository": "quay.io/sample", "tag": "v1.2.4"},
+				"replicas": 3,
+				"hosts":    []interface{}{"sample.prod.example.com"},
+			},
+		},
+		{
+			name: "Check unscoped lists can be appended and combined with scoped files",
+			args: []string{
+				"--config-data-list-merge", ListMergeAppend,
+				"--config-data", "./test/TestConfigData/values.yaml",
+				"--config-data", "./test/TestConfigData/values-prod.yaml",
+				"--config-data", "Data=./test/TestConfigData/simple.yaml",
+			},
+			want: map[string]interface{}{
+				"image":    map[string]interface{}{"repository": "quay.io/sample", "tag": "v1.2.4"},
+				"replicas": 3,
+				"hosts":    []interface{}{"sample.example.com", "sample.prod.example.com"},
+				"Data":     map[string]interface{}{"data": "value"},
+			},
+		},
+		{
+			name: "Check env file is combined with config data",
+			args: []string{
+				"--config", "./test/TestConfigData/simple.env",
+				"--config-data", "./test/TestConfigData/simple.yaml",
+			},
+			want: map[string]interface{}{
+				"DATA": "value",
+				"data": "value",
+			},
+		},
+		{
+			name: "Check json and toml files are layered",
+			args: []string{
+				"--config-data", "./test/TestConfigData/values.yaml",
+				"--config-data", "./test/TestConfigData/values.json",
+				"--config-data", "./test/TestConfigData/values.toml",
+			},
+			want: map[string]interface{}{
+				"image":    map[string]interface{}{"repository": "quay.io/sample", "tag": "v1.2.6"},
+				"replicas": int64(5),
+				"ports": []interface{}{
+					map[string]interface{}{"name": "http", "port": int64(8080)},
+				},
+			},
+		},
+		{
+			name: "Check json numbers are typed",
+			args: []string{
+				"--config-data", "./test/TestConfigData/values.json",
+			},
+			want: map[string]interface{}{
+				"replicas": int64(4),
+			},
+		},
+		{
+			name: "Check scoped env file is loaded into scope only",
+			args: []string{
+				"--config-data", "Env=./test/TestConfigData/scoped.env",
+			},
+			want: map[string]interface{}{
+				"Env":                map[string]interface{}{"KD_TEST_SCOPED_ENV": "scoped-value"},
+				"KD_TEST_SCOPED_ENV": nil,
+			},
+		},
+		{
+			name: "Check typed environment is available at .Env",
+			args: []string{
+				"--typed-env",
+			},
+			want: map[string]interface{}{
+				"KD_TEST_TYPED_INT": int64(3),
+				"Env": map[string]interface{}{
+					"KD_TEST_TYPED_INT":  int64(3),
+					"KD_TEST_TYPED_BOOL": false,
+				},
+			},
+		},
+		{
+			name: "Check set values override config data",
+			args: []string{
+				"--config-data", "./test/TestConfigData/values.yaml",
+				"--set", "image.tag=v2.0.0,hosts[1]=extra.example.com",
+				"--set-string", "replicas=2",
+				"--set-file", "script=./test/TestConfigData/simple.env",
+			},
+			want: map[string]interface{}{
+				"image":    map[string]interface{}{"repository": "quay.io/sample", "tag": "v2.0.0"},
+				"replicas": "2",
+				"hosts":    []interface{}{"sample.example.com", "extra.example.com"},
+				"script":   "DATA=value\n",
+			},
+		},
+	}
+
+	os.Setenv("KD_TEST_TYPED_INT", "3")
+	os.Setenv("KD_TEST_TYPED_BOOL", "false")
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conf, err := GetAnyConfigData(newTestContext(flags, c.args))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			got := conf.(map[string]interface{})
+			for k, want := range c.want {
+				if k == EnvScope {
+					// Only compare the environment variables specified
+					for envKey, envWant := range want.(map[string]interface{}) {
+						envGot := got[EnvScope].(map[string]interface{})[envKey]
+						if !reflect.DeepEqual(envGot, envWant) {
+							t.Errorf("key %s.%s got: %#v\nwant: %#v\n", k, envKey, envGot, envWant)
+						}
+					}
+					continue
+				}
+				if !reflect.DeepEqual(got[k], want) {
+					t.Errorf("key %s got: %#v\nwant: %#v\n", k, got[k], want)
+				}
+			}
+		})
+	}
+
+	t.Run("Check set values conflicting with config data are an error", func(t *testing.T) {
+		_, err := GetAnyConfigData(newTestContext(flags, []string{
+			"--config-data", "./test/TestConfigData/values.yaml",
+			"--set", "replicas.count=1",
+		}))
+		if err == nil {
+			t.Errorf("expected an error setting a key below a scalar value")
+		}
+	})
+}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// FlagNamespaceMode sets how resources with a namespace other than
+	// --namespace are handled, reject or rewrite
+	FlagNamespaceMode = "namespace-mode"
+	// FlagAllowedNamespace only allows resources to be deployed to these namespaces
+	FlagAllowedNamespace = "allowed-namespace"
+	// FlagInjectNamespace sets metadata.namespace on all namespaced resources
+	FlagInjectNamespace = "inject-namespace"
+
+	// NamespaceModeReject fails when a resource targets another namespace
+	NamespaceModeReject = "reject"
+	// NamespaceModeRewrite changes the namespace of resources targeting
+	// another namespace to --namespace
+	NamespaceModeRewrite = "rewrite"
+)
+
+// clusterScopedKinds are the kinds which don't have a namespace, the built-in
+// kinds are added to with those the cluster reports by
+// discoverClusterScopedKinds
+var clusterScopedKinds = map[string]bool{
+	"apiservice":                       true,
+	"certificatesigningrequest":        true,
+	"clusterrole":                      true,
+	"clusterrolebinding":               true,
+	"clustertrustbundle":               true,
+	"componentstatus":                  true,
+	"csidriver":                        true,
+	"csinode":                          true,
+	"customresourcedefinition":         true,
+	"deviceclass":                      true,
+	"flowschema":                       true,
+	"ingressclass":                     true,
+	"ipaddress":                        true,
+	"mutatingadmissionpolicy":          true,
+	"mutatingadmissionpolicybinding":   true,
+	"mutatingwebhookconfiguration":     true,
+	"namespace":                        true,
+	"node":                             true,
+	"persistentvolume":                 true,
+	"podsecuritypolicy":                true,
+	"priorityclass":                    true,
+	"prioritylevelconfiguration":       true,
+	"resourceslice":                    true,
+	"runtimeclass":                     true,
+	"selfsubjectaccessreview":          true,
+	"selfsubjectreview":                true,
+	"selfsubjectrulesreview":           true,
+	"servicecidr":                      true,
+	"storageclass":                     true,
+	"storageversion":                   true,
+	"storageversionmigration":          true,
+	"subjectaccessreview":              true,
+	"tokenreview":                      true,
+	"validatingadmissionpolicy":        true,
+	"validatingadmissionpolicybinding": true,
+	"validatingwebhookconfiguration":   true,
+	"volumeattachment":                 true,
+	"volumeattributesclass":            true,
+}
+
+// isClusterScoped reports if a kind of resource has no namespace
+func isClusterScoped(kind string) bool {
+	return clusterScopedKinds[strings.ToLower(kind)]
+}
+
+// discoverClusterScopedKinds adds the cluster scoped kinds the cluster serves
+// (including custom resources) to clusterScopedKinds, keeping the built-in
+// kinds when the cluster can't be reached
+func discoverClusterScopedKinds(c *cli.Context) {
+	cmd, err := newKubeCmd(c, []string{"api-resources", "--namespaced=false", "--no-headers"}, false)
+	if err != nil {
+		logDebug.Printf("unable to discover cluster scoped kinds, using the built-in kinds:%s", err)
+		return
+	}
+	var errbuf bytes.Buffer
+	cmd.Stderr = &errbuf
+	out, err := cmd.Output()
+	// Some api groups may be unavailable so use any kinds listed on error
+	kinds := apiResourceKinds(out)
+	if err != nil {
+		if errbuf.Len() > 0 {
+			err = fmt.Errorf("%s", redact(strings.TrimSpace(errbuf.String())))
+		}
+		logDebug.Printf("unable to discover all cluster scoped kinds, using the built-in kinds and %d discovered:%s", len(kinds), err)
+	}
+	for _, kind := range kinds {
+		clusterScopedKinds[strings.ToLower(kind)] = true
+	}
+}
+
+// apiResourceKinds gets the kinds from kubectl api-resources --no-headers
+// output, the kind is the last column
+func apiResourceKinds(out []byte) []string {
+	var kinds []string
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			kinds = append(kinds, fields[len(fields)-1])
+		}
+	}
+	return kinds
+}
+
+// enforceNamespaces rewrites or injects the namespace of the rendered
+// resources as configured and checks they are only deployed to the allowed
+// namespaces
+func enforceNamespaces(c *cli.Context, resources []*ObjectResource) error {
+	namespace := c.String("namespace")
+	mode := c.String(FlagNamespaceMode)
+	if mode == "" {
+		mode = NamespaceModeReject
+	}
+	if mode != NamespaceModeReject && mode != NamespaceModeRewrite {
+		return fmt.Errorf("invalid namespace mode %s, expecting %s or %s",
+			mode, NamespaceModeReject, NamespaceModeRewrite)
+	}
+	allowed := c.StringSlice(FlagAllowedNamespace)
+	var problems []string
+	for _, r := range resources {
+		if r.Kind == "" || isClusterScoped(r.Kind) {
+			continue
+		}
+		if namespace != "" && r.Namespace != namespace {
+			rewrite := mode == NamespaceModeRewrite && r.Namespace != ""
+			inject := c.Bool(FlagInjectNamespace) && r.Namespace == ""
+			if rewrite || inject {
+				if rewrite {
+					logEvent(logInfo, resourceFields("rewrite-namespace", r), "rewriting namespace of %s/%s from %s to %s",
+						strings.ToLower(r.Kind), r.Name, r.Namespace, namespace)
+				}
+				if err := setNamespace(r, namespace); err != nil {
+					return err
+				}
+			}
+		}
+		if len(allowed) == 0 {
+			continue
+		}
+		resourceNamespace := r.Namespace
+		if resourceNamespace == "" {
+			resourceNamespace = namespace
+		}
+		if resourceNamespace == "" {
+			problems = append(problems, fmt.Sprintf(
+				"%s/%s (from file:%q) has no namespace, set --namespace to deploy to one of %s",
+				strings.ToLower(r.Kind), r.Name, r.FileName, strings.Join(allowed, ", ")))
+		} else if !containsString(allowed, resourceNamespace) {
+			problems = append(problems, fmt.Sprintf(
+				"%s/%s (from file:%q) targets namespace %s which is not one of %s",
+				strings.ToLower(r.Kind), r.Name, r.FileName, resourceNamespace, strings.Join(allowed, ", ")))
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("resources not in an allowed namespace:\n%s", strings.Join(problems, "\n"))
+	}
+	return nil
+}
+
+// setNamespace sets metadata.namespace in the template of a resource, only
+// editing that line unless the metadata is in flow style
+func setNamespace(r *ObjectResource, namespace string) error {
+	if tmpl, ok := setTemplateValue(r.Template, []string{"metadata", "namespace"}, namespace); ok {
+		r.Template = tmpl
+		r.Namespace = namespace
+		return nil
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(r.Template, &doc); err != nil {
+		return fmt.Errorf("error setting namespace of %s/%s (from file:%q):%s", r.Kind, r.Name, r.FileName, err)
+	}
+	set := false
+	for i, item := range doc {
+		if item.Key != "metadata" {
+			continue
+		}
+		meta, _ := item.Value.(yaml.MapSlice)
+		doc[i].Value = setMapSliceValue(meta, "namespace", namespace)
+		set = true
+	}
+	if !set {
+		doc = append(doc, yaml.MapItem{Key: "metadata", Value: yaml.MapSlice{{Key: "namespace", Value: namespace}}})
+	}
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	r.Template = b
+	r.Namespace = namespace
+	return nil
+}
+
+// setTemplateValue sets the value at a path of keys in a yaml template by
+// editing its text, so the rest of the document (key order, comments and
+// block scalars) is kept as written. Missing keys are added at the end of
+// their parent. It reports false when the template can't be edited this way
+// e.g. when it is JSON or a parent is in flow style.
+func setTemplateValue(tmpl []byte, path []string, value string) ([]byte, bool) {
+	lines := strings.SplitAfter(string(tmpl), "\n")
+	for _, line := range lines {
+		if isYamlContent(line) {
+			if t := strings.TrimSpace(line); strings.HasPrefix(t, "{") || strings.HasPrefix(t, "[") {
+				return nil, false
+			}
+			break
+		}
+	}
+	encoded, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, false
+	}
+	// yaml.v2 folds long strings over several lines
+	scalar := strings.TrimSuffix(string(encoded), "\n")
+	if strings.Contains(scalar, "\n") {
+		scalar = strconv.Quote(value)
+	}
+	start, end, parentIndent, step := 0, len(lines), -1, 2
+	for depth, key := range path {
+		// The keys of a map are all at the indent of its first key
+		indent := parentIndent + step
+		if depth == 0 {
+			indent = 0
+		}
+		for i := start; i < end; i++ {
+			if isYamlContent(lines[i]) {
+				indent = yamlIndent(lines[i])
+				break
+			}
+		}
+		if depth > 0 {
+			step = indent - parentIndent
+		}
+		found, colon := -1, 0
+		for i := start; i < end && found < 0; i++ {
+			if !isYamlContent(lines[i]) || yamlIndent(lines[i]) != indent {
+				continue
+			}
+			if k, at, ok := yamlKey(lines[i]); ok && k == key {
+				found, colon = i, at
+			}
+		}
+		if found < 0 {
+			// Add the rest of the path after the last line of the parent
+			at := start
+			for i := start; i < end; i++ {
+				if isYamlContent(lines[i]) {
+					at = i + 1
+				}
+			}
+			if at > 0 && !strings.HasSuffix(lines[at-1], "\n") {
+				lines[at-1] += "\n"
+			}
+			var added []string
+			for i, k := range path[depth:] {
+				line := strings.Repeat(" ", indent+i*step) + k + ":"
+				if depth+i == len(path)-1 {
+					line += " " + scalar
+				}
+				added = append(added, line+"\n")
+			}
+			lines = append(lines[:at], append(added, lines[at:]...)...)
+			return []byte(strings.Join(lines, "")), true
+		}
+		// The value of the key is any more indented lines which follow
+		blockEnd := found + 1
+		for i := found + 1; i < end; i++ {
+			if isYamlContent(lines[i]) {
+				if yamlIndent(lines[i]) <= indent {
+					break
+				}
+				blockEnd = i + 1
+			}
+		}
+		if depth == len(path)-1 {
+			line := lines[found][:colon+1] + " " + scalar
+			if strings.HasSuffix(lines[blockEnd-1], "\n") {
+				line += "\n"
+			}
+			lines = append(lines[:found], append([]string{line}, lines[blockEnd:]...)...)
+			return []byte(strings.Join(lines, "")), true
+		}
+		rest := strings.TrimSpace(lines[found][colon+1:])
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			return nil, false
+		}
+		start, end, parentIndent = found+1, blockEnd, indent
+	}
+	return nil, false
+}
+
+// isYamlContent reports if a line of yaml is more than a comment, a blank
+// line or a document marker
+func isYamlContent(line string) bool {
+	t := strings.TrimSpace(line)
+	return t != "" && !strings.HasPrefix(t, "#") && t != "---" && t != "..."
+}
+
+// yamlIndent is the number of spaces a line of yaml is indented by
+func yamlIndent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// yamlKey gets the (unquoted) map key of a line of yaml and the position of
+// the colon following it
+func yamlKey(line string) (string, int, bool) {
+	offset := yamlIndent(line)
+	t := strings.TrimRight(line[offset:], "\r\n")
+	if t == "" {
+		return "", 0, false
+	}
+	if q := t[0]; q == '"' || q == '\'' {
+		end := strings.IndexByte(t[1:], q)
+		if end < 0 || len(t) < end+3 || t[end+2] != ':' {
+			return "", 0, false
+		}
+		return t[1 : end+1], offset + end + 2, true
+	}
+	for i := 0; i < len(t); i++ {
+		if t[i] == ':' && (i == len(t)-1 || t[i+1] == ' ' || t[i+1] == '\t') {
+			return t[:i], offset + i, true
+		}
+	}
+	return "", 0, false
+}
+
+// setMapSliceValue sets a key in an ordered yaml map, adding it if missing
+func setMapSliceValue(m yaml.MapSlice, key string, value interface{}) yaml.MapSlice {
+	for i, item := range m {
+		if item.Key == key {
+			m[i].Value = value
+			return m
+		}
+	}
+	return append(m, yaml.MapItem{Key: key, Value: value})
+}
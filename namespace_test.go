@@ -0,0 +1,167 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestEnforceNamespaces(t *testing.T) {
+	flags := []cli.Flag{
+		cli.StringFlag{Name: "namespace"},
+		cli.StringFlag{Name: FlagNamespaceMode},
+		cli.StringSliceFlag{Name: FlagAllowedNamespace},
+		cli.BoolFlag{Name: FlagInjectNamespace},
+	}
+	templates := []string{
+		"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n",
+		"apiVersion: v1\nkind: Service\nmetadata:\n  name: app\n  namespace: other\n",
+		"apiVersion: v1\nkind: Namespace\nmetadata:\n  name: dev\n",
+	}
+	cases := []struct {
+		name      string
+		args      []string
+		want      []string
+		wantError string
+	}{
+		{
+			name: "leaves namespaces by default",
+			args: []string{"--namespace", "dev"},
+			want: templates,
+		},
+		{
+			name: "injects and rewrites namespaces",
+			args: []string{"--namespace", "dev", "--namespace-mode", "rewrite", "--inject-namespace"},
+			want: []string{
+				"apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n  namespace: dev\n",
+				"apiVersion: v1\nkind: Service\nmetadata:\n  name: app\n  namespace: dev\n",
+				templates[2],
+			},
+		},
+		{
+			name:      "rejects namespaces not allowed",
+			args:      []string{"--allowed-namespace", "dev", "--allowed-namespace", "other"},
+			wantError: "resources not in an allowed namespace:\n" + `deployment/app (from file:"app.yaml") has no namespace, set --namespace to deploy to one of dev, other`,
+		},
+		{
+			name:      "rejects injected namespaces not allowed",
+			args:      []string{"--namespace", "dev", "--allowed-namespace", "dev"},
+			wantError: "resources not in an allowed namespace:\n" + `service/app (from file:"app.yaml") targets namespace other which is not one of dev`,
+		},
+		{
+			name:      "invalid mode",
+			args:      []string{"--namespace-mode", "ignore"},
+			wantError: "invalid namespace mode ignore, expecting reject or rewrite",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var resources []*ObjectResource
+			for _, tmpl := range templates {
+				r := &ObjectResource{FileName: "app.yaml", Template: []byte(tmpl)}
+				if err := yaml.Unmarshal(r.Template, r); err != nil {
+					t.Fatal(err)
+				}
+				resources = append(resources, r)
+			}
+			err := enforceNamespaces(newTestContext(flags, c.args), resources)
+			if c.wantError != "" {
+				if err == nil || err.Error() != c.wantError {
+					t.Errorf("got error: %v\nwant: %s", err, c.wantError)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, r := range resources {
+				got = append(got, string(r.Template))
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
+func TestSetTemplateValue(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		path     []string
+		value    string
+		want     string
+		wantOK   bool
+	}{
+		{
+			name:     "Check only the value is changed",
+			template: "# app\nkind: ConfigMap\nmetadata:\n  namespace: other # old\n  name: app\ndata:\n  script: |\n    echo hi\n\n    exit 0\n",
+			path:     []string{"metadata", "namespace"},
+			value:    "dev",
+			want:     "# app\nkind: ConfigMap\nmetadata:\n  namespace: dev\n  name: app\ndata:\n  script: |\n    echo hi\n\n    exit 0\n",
+			wantOK:   true,
+		},
+		{
+			name:     "Check a missing key is added at the end of its parent",
+			template: "kind: ConfigMap\nmetadata:\n    name: app\n    labels:\n        app: web\n# data\ndata:\n  a: b",
+			path:     []string{"metadata", "namespace"},
+			value:    "dev",
+			want:     "kind: ConfigMap\nmetadata:\n    name: app\n    labels:\n        app: web\n    namespace: dev\n# data\ndata:\n  a: b",
+			wantOK:   true,
+		},
+		{
+			name:     "Check missing parents are added",
+			template: "kind: ConfigMap\nmetadata:\n    name: app\n",
+			path:     []string{"metadata", "annotations", "kd.homeoffice.gov.uk/deployed-by"},
+			value:    "alice",
+			want:     "kind: ConfigMap\nmetadata:\n    name: app\n    annotations:\n        kd.homeoffice.gov.uk/deployed-by: alice\n",
+			wantOK:   true,
+		},
+		{
+			name:     "Check quoted keys and values which need quoting",
+			template: "kind: ConfigMap\nmetadata:\n  \"namespace\": other\n",
+			path:     []string{"metadata", "namespace"},
+			value:    "123",
+			want:     "kind: ConfigMap\nmetadata:\n  \"namespace\": \"123\"\n",
+			wantOK:   true,
+		},
+		{
+			name:     "Check JSON can't be edited",
+			template: "{\n  \"kind\": \"ConfigMap\",\n  \"metadata\": {\n    \"name\": \"app\"\n  }\n}\n",
+			path:     []string{"metadata", "namespace"},
+			value:    "dev",
+		},
+		{
+			name:     "Check a flow style parent can't be edited",
+			template: "kind: ConfigMap\nmetadata: {name: app}\n",
+			path:     []string{"metadata", "namespace"},
+			value:    "dev",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, ok := setTemplateValue([]byte(c.template), c.path, c.value)
+			if ok != c.wantOK {
+				t.Fatalf("got ok: %t, want: %t", ok, c.wantOK)
+			}
+			if string(got) != c.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, c.want)
+			}
+		})
+	}
+}
+
+func TestApiResourceKinds(t *testing.T) {
+	out := []byte(`namespaces                        ns           v1                                false        Namespace
+clusterroles                                   rbac.authorization.k8s.io/v1      false        ClusterRole
+clusterissuers                                 cert-manager.io/v1                false        ClusterIssuer
+`)
+	want := []string{"Namespace", "ClusterRole", "ClusterIssuer"}
+	if got := apiResourceKinds(out); !reflect.DeepEqual(got, want) {
+		t.Errorf("got: %#v\nwant: %#v\n", got, want)
+	}
+}
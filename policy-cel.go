@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/checker/decls"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// FlagPolicyDir loads user defined CEL policies from files or directories
+const FlagPolicyDir = "policy-dir"
+
+// UserPolicy is a user defined policy of CEL expressions which must all be
+// true for a resource to be allowed e.g.
+//
+//	name: team-label
+//	kinds: [Deployment]
+//	validations:
+//	- expression: "'team' in object.metadata.labels"
+//	  message: deployments must have a team label
+type UserPolicy struct {
+	Name string `yaml:"name"`
+	// Severity is fail (the default) or warn
+	Severity string `yaml:"severity"`
+	// Kinds limits the policy to resources of these kinds
+	Kinds       []string         `yaml:"kinds"`
+	Validations []UserValidation `yaml:"validations"`
+	File        string           `yaml:"-"`
+}
+
+// UserValidation is a CEL expression and the message reported when it is false
+type UserValidation struct {
+	Expression string      `yaml:"expression"`
+	Message    string      `yaml:"message"`
+	program    cel.Program `yaml:"-"`
+}
+
+// newPolicyEnv creates the CEL environment policies are evaluated in, with
+// the resource as object, the run context (namespace and kube context) as run
+// and the config data as config
+func newPolicyEnv() (*cel.Env, error) {
+	return cel.NewEnv(cel.Declarations(
+		decls.NewVar("object", decls.NewMapType(decls.String, decls.Dyn)),
+		decls.NewVar("run", decls.NewMapType(decls.String, decls.String)),
+		decls.NewVar("config", decls.NewMapType(decls.String, decls.Dyn)),
+	))
+}
+
+// loadUserPolicies loads and compiles the policies in yaml files or
+// directories of yaml files
+func loadUserPolicies(paths []string) ([]*UserPolicy, error) {
+	env, err := newPolicyEnv()
+	if err != nil {
+		return nil, err
+	}
+	var policies []*UserPolicy
+	for _, p := range paths {
+		stat, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		files := []string{p}
+		if stat.IsDir() {
+			if files, err = ListDirectory(p); err != nil {
+				return nil, err
+			}
+		}
+		for _, f := range files {
+			loaded, err := loadUserPolicyFile(env, f)
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, loaded...)
+		}
+	}
+	return policies, nil
+}
+
+// loadUserPolicyFile loads and compiles all the policies in a file
+func loadUserPolicyFile(env *cel.Env, f string) ([]*UserPolicy, error) {
+	data, err := ioutil.ReadFile(f)
+	if err != nil {
+		return nil, err
+	}
+	var policies []*UserPolicy
+	for _, d := range splitYamlDocs(string(data)) {
+		p := &UserPolicy{File: f}
+		if err := yaml.UnmarshalStrict([]byte(d), p); err != nil {
+			return nil, fmt.Errorf("error parsing policy file '%s':%s", f, err)
+		}
+		if p.Name == "" {
+			return nil, fmt.Errorf("policy in '%s' has no name", f)
+		}
+		if p.Severity == "" {
+			p.Severity = PolicyFail
+		}
+		if p.Severity != PolicyFail && p.Severity != PolicyWarn {
+			return nil, fmt.Errorf("invalid severity %s for policy %s, expecting %s or %s",
+				p.Severity, p.Name, PolicyFail, PolicyWarn)
+		}
+		for i := range p.Validations {
+			v := &p.Validations[i]
+			ast, issues := env.Compile(v.Expression)
+			if issues != nil && issues.Err() != nil {
+				return nil, fmt.Errorf("invalid expression in policy %s (%s):%s", p.Name, f, issues.Err())
+			}
+			if v.program, err = env.Program(ast); err != nil {
+				return nil, fmt.Errorf("invalid expression in policy %s (%s):%s", p.Name, f, err)
+			}
+		}
+		logDebug.Printf("loaded policy %s from %s", p.Name, f)
+		policies = append(policies, p)
+	}
+	return policies, nil
+}
+
+// Check evaluates all the validations of a policy against a resource
+func (p *UserPolicy) Check(obj map[string]interface{}, run map[string]string, config map[string]interface{}) []string {
+	if len(p.Kinds) > 0 {
+		matched := false
+		for _, kind := range p.Kinds {
+			matched = matched || kindMatches(kind, fmt.Sprintf("%v", obj["kind"]))
+		}
+		if !matched {
+			return nil
+		}
+	}
+	vars := map[string]interface{}{
+		"object": obj,
+		"run":    run,
+		"config": config,
+	}
+	var violations []string
+	for _, v := range p.Validations {
+		out, _, err := v.program.Eval(vars)
+		if err != nil {
+			violations = append(violations, fmt.Sprintf("error evaluating %q:%s", v.Expression, err))
+			continue
+		}
+		if allowed, ok := out.Value().(bool); !ok {
+			violations = append(violations, fmt.Sprintf("expression %q is not a boolean", v.Expression))
+		} else if !allowed {
+			message := v.Message
+			if message == "" {
+				message = fmt.Sprintf("failed expression %q", v.Expression)
+			}
+			violations = append(violations, message)
+		}
+	}
+	return violations
+}
+
+// checkUserPolicies checks a resource against the user defined policies,
+// skipping any the resource is exempt from
+func checkUserPolicies(policies []*UserPolicy, r *ObjectResource, run map[string]string, config map[string]interface{}) []LintFinding {
+	var doc interface{}
+	if err := yaml.Unmarshal(r.Template, &doc); err != nil {
+		return nil
+	}
+	obj, ok := toStringMap(doc)
+	if !ok || r.Kind == "" {
+		return nil
+	}
+	exempt := policyExemptions(r)
+	var findings []LintFinding
+	for _, p := range policies {
+		if exempt[p.Name] || exempt["all"] {
+			continue
+		}
+		severity := LintSeverityError
+		if p.Severity == PolicyWarn {
+			severity = LintSeverityWarning
+		}
+		for _, message := range p.Check(obj, run, config) {
+			findings = append(findings, LintFinding{
+				File:     r.FileName,
+				Severity: severity,
+				Rule:     p.Name,
+				Message:  fmt.Sprintf("%s/%s: %s", strings.ToLower(r.Kind), r.Name, message),
+			})
+		}
+	}
+	return findings
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// FlagPolicy checks the rendered resources against the built-in policies
+	FlagPolicy = "policy"
+	// FlagPolicyConfig is a file configuring the policy rules
+	FlagPolicyConfig = "policy-config"
+	// FlagPolicyRule sets the severity of a policy rule e.g. probes=fail
+	FlagPolicyRule = "policy-rule"
+
+	// PolicyExemptAnnotation lists the rules a resource is exempt from e.g.
+	// "latest-tag,probes" or "all"
+	PolicyExemptAnnotation = "kd.homeoffice.gov.uk/policy-exempt"
+
+	// PolicyFail fails a deployment when a rule is violated
+	PolicyFail = "fail"
+	// PolicyWarn reports violations of a rule without failing
+	PolicyWarn = "warn"
+	// PolicyOff disables a rule
+	PolicyOff = "off"
+)
+
+// policyRule checks a resource, returning a message for each violation
+type policyRule func(p *PolicyConfig, obj map[string]interface{}) []string
+
+// policyRules are the built-in rules by name
+var policyRules = map[string]policyRule{
+	"resource-limits": checkResourceLimits,
+	"latest-tag":      checkLatestTag,
+	"probes":          checkProbes,
+	"privileged":      checkPrivileged,
+	"required-labels": checkRequiredLabels,
+}
+
+// defaultPolicySeverities are the severities used unless configured
+var defaultPolicySeverities = map[string]string{
+	"resource-limits": PolicyWarn,
+	"latest-tag":      PolicyFail,
+	"probes":          PolicyWarn,
+	"privileged":      PolicyFail,
+	"required-labels": PolicyFail,
+}
+
+// PolicyConfig configures the policy rules
+type PolicyConfig struct {
+	// Rules sets the severity (fail, warn or off) of rules by name
+	Rules map[string]string `yaml:"rules"`
+	// RequiredLabels are the labels every resource must have
+	RequiredLabels []string `yaml:"requiredLabels"`
+}
+
+// policyEnabled reports if any policy checks have been requested
+func policyEnabled(c *cli.Context) bool {
+	return builtinPolicyEnabled(c) || len(c.StringSlice(FlagPolicyDir)) > 0
+}
+
+// builtinPolicyEnabled reports if the built-in policy checks have been requested
+func builtinPolicyEnabled(c *cli.Context) bool {
+	return c.Bool(FlagPolicy) || c.String(FlagPolicyConfig) != "" || len(c.StringSlice(FlagPolicyRule)) > 0
+}
+
+// loadPolicyConfig creates the policy configuration from the defaults, any
+// config file and then any rule flags
+func loadPolicyConfig(c *cli.Context) (*PolicyConfig, error) {
+	p := &PolicyConfig{}
+	if fn := c.String(FlagPolicyConfig); fn != "" {
+		data, err := ioutil.ReadFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.UnmarshalStrict(data, p); err != nil {
+			return nil, fmt.Errorf("error parsing policy config '%s':%s", fn, err)
+		}
+	}
+	rules := map[string]string{}
+	for name, severity := range defaultPolicySeverities {
+		rules[name] = severity
+	}
+	for name, severity := range p.Rules {
+		rules[name] = severity
+	}
+	for _, rule := range c.StringSlice(FlagPolicyRule) {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid policy rule %s, expecting name=%s|%s|%s", rule, PolicyFail, PolicyWarn, PolicyOff)
+		}
+		rules[parts[0]] = parts[1]
+	}
+	for name, severity := range rules {
+		if _, ok := policyRules[name]; !ok {
+			return nil, fmt.Errorf("unknown policy rule %s", name)
+		}
+		if severity != PolicyFail && severity != PolicyWarn && severity != PolicyOff {
+			return nil, fmt.Errorf("invalid severity %s for policy rule %s, expecting %s, %s or %s",
+				severity, name, PolicyFail, PolicyWarn, PolicyOff)
+		}
+	}
+	p.Rules = rules
+	return p, nil
+}
+
+// Check runs all the enabled rules over a resource, skipping any rules the
+// resource is exempt from
+func (p *PolicyConfig) Check(r *ObjectResource) []LintFinding {
+	var doc interface{}
+	if err := yaml.Unmarshal(r.Template, &doc); err != nil {
+		return nil
+	}
+	obj, ok := toStringMap(doc)
+	if !ok || r.Kind == "" {
+		return nil
+	}
+	exempt := policyExemptions(r)
+	names := make([]string, 0, len(p.Rules))
+	for name := range p.Rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var findings []LintFinding
+	for _, name := range names {
+		if p.Rules[name] == PolicyOff || exempt[name] || exempt["all"] {
+			continue
+		}
+		severity := LintSeverityWarning
+		if p.Rules[name] == PolicyFail {
+			severity = LintSeverityError
+		}
+		for _, message := range policyRules[name](p, obj) {
+			findings = append(findings, LintFinding{
+				File:     r.FileName,
+				Severity: severity,
+				Rule:     name,
+				Message:  fmt.Sprintf("%s/%s: %s", strings.ToLower(r.Kind), r.Name, message),
+			})
+		}
+	}
+	return findings
+}
+
+// policyExemptions gets the rules a resource is exempt from
+func policyExemptions(r *ObjectResource) map[string]bool {
+	exempt := map[string]bool{}
+	for _, name := range strings.Split(r.Annotations[PolicyExemptAnnotation], ",") {
+		exempt[strings.TrimSpace(name)] = true
+	}
+	return exempt
+}
+
+// checkPolicies checks all the rendered resources against the built-in and
+// user defined policies reporting all the violations at once
+func checkPolicies(c *cli.Context, conf interface{}, resources []*ObjectResource) error {
+	var findings []LintFinding
+	if builtinPolicyEnabled(c) {
+		p, err := loadPolicyConfig(c)
+		if err != nil {
+			return err
+		}
+		for _, r := range resources {
+			findings = append(findings, p.Check(r)...)
+		}
+	}
+	if paths := c.StringSlice(FlagPolicyDir); len(paths) > 0 {
+		policies, err := loadUserPolicies(paths)
+		if err != nil {
+			return err
+		}
+		run := map[string]string{
+			"namespace": c.String("namespace"),
+			"context":   c.String("context"),
+		}
+		config, _ := toStringMap(conf)
+		for _, r := range resources {
+			findings = append(findings, checkUserPolicies(policies, r, run, config)...)
+		}
+	}
+	if err := reportFindings("policy", findings); err != nil {
+		return err
+	}
+	logInfo.Printf("checked %d resources against policies", len(resources))
+	return nil
+}
+
+// podSpec gets the pod spec of a pod or a workload resource
+func podSpec(obj map[string]interface{}) (map[string]interface{}, bool) {
+	var path string
+	switch obj["kind"] {
+	case "Pod":
+		path = ".spec"
+	case "Deployment", "StatefulSet", "DaemonSet", "ReplicaSet", "ReplicationController", "Job":
+		path = ".spec.template.spec"
+	case "CronJob":
+		path = ".spec.jobTemplate.spec.template.spec"
+	default:
+		return nil, false
+	}
+	spec, found := valueAtPath(obj, path)
+	if !found {
+		return nil, false
+	}
+	return toStringMap(spec)
+}
+
+// podContainers gets the containers (and optionally init containers) of a pod
+// or a workload resource
+func podContainers(obj map[string]interface{}, includeInit bool) []map[string]interface{} {
+	spec, ok := podSpec(obj)
+	if !ok {
+		return nil
+	}
+	keys := []string{"containers"}
+	if includeInit {
+		keys = append(keys, "initContainers")
+	}
+	var containers []map[string]interface{}
+	for _, key := range keys {
+		list, _ := spec[key].([]interface{})
+		for _, item := range list {
+			if container, ok := toStringMap(item); ok {
+				containers = append(containers, container)
+			}
+		}
+	}
+	return containers
+}
+
+// containerName gets the name of a container for messages
+func containerName(container map[string]interface{}) string {
+	return fmt.Sprintf("%v", container["name"])
+}
+
+// checkResourceLimits requires cpu and memory limits for all containers
+func checkResourceLimits(p *PolicyConfig, obj map[string]interface{}) []string {
+	var violations []string
+	for _, container := range podContainers(obj, true) {
+		for _, resource := range []string{"cpu", "memory"} {
+			if _, found := valueAtPath(container, ".resources.limits."+resource); !found {
+				violations = append(violations, fmt.Sprintf("container %s has no %s limit", containerName(container), resource))
+			}
+		}
+	}
+	return violations
+}
+
+// checkLatestTag requires all images to have a tag (or digest) other than latest
+func checkLatestTag(p *PolicyConfig, obj map[string]interface{}) []string {
+	var violations []string
+	for _, container := range podContainers(obj, true) {
+		image, _ := container["image"].(string)
+		if strings.Contains(image, "@") {
+			continue
+		}
+		tag := ""
+		// Ignore any registry port e.g. registry:5000/app
+		if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+			tag = image[i+1:]
+		}
+		if tag == "" || tag == "latest" {
+			violations = append(violations, fmt.Sprintf("container %s image %q uses the latest tag", containerName(container), image))
+		}
+	}
+	return violations
+}
+
+// checkProbes requires readiness and liveness probes for long running containers
+func checkProbes(p *PolicyConfig, obj map[string]interface{}) []string {
+	if obj["kind"] == "Job" || obj["kind"] == "CronJob" {
+		return nil
+	}
+	var violations []string
+	for _, container := range podContainers(obj, false) {
+		for _, probe := range []string{"readinessProbe", "livenessProbe"} {
+			if container[probe] == nil {
+				violations = append(violations, fmt.Sprintf("container %s has no %s", containerName(container), probe))
+			}
+		}
+	}
+	return violations
+}
+
+// checkPrivileged forbids privileged containers
+func checkPrivileged(p *PolicyConfig, obj map[string]interface{}) []string {
+	var violations []string
+	for _, container := range podContainers(obj, true) {
+		if privileged, _ := valueAtPath(container, ".securityContext.privileged"); privileged == true {
+			violations = append(violations, fmt.Sprintf("container %s is privileged", containerName(container)))
+		}
+	}
+	return violations
+}
+
+// checkRequiredLabels requires the configured labels on every resource
+func checkRequiredLabels(p *PolicyConfig, obj map[string]interface{}) []string {
+	labels := objectLabels(obj)
+	var violations []string
+	for _, label := range p.RequiredLabels {
+		if _, found := labels[label]; !found {
+			violations = append(violations, fmt.Sprintf("missing required label %s", label))
+		}
+	}
+	return violations
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+var policyFlags = []cli.Flag{
+	cli.StringFlag{Name: FlagPolicyConfig},
+	cli.StringSliceFlag{Name: FlagPolicyRule},
+}
+
+func TestPolicyCheck(t *testing.T) {
+	cases := []struct {
+		name     string
+		args     []string
+		template string
+		want     []string
+	}{
+		{
+			name: "compliant deployment",
+			template: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+      - name: app
+        image: registry:5000/app:v1
+        readinessProbe: {httpGet: {port: 80}}
+        livenessProbe: {httpGet: {port: 80}}
+        resources:
+          limits: {cpu: 100m, memory: 128Mi}
+`,
+		},
+		{
+			name: "all default rules",
+			template: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      initContainers:
+      - name: init
+        image: registry:5000/init
+        resources:
+          limits: {cpu: 100m, memory: 128Mi}
+      containers:
+      - name: app
+        image: app:latest
+        readinessProbe: {httpGet: {port: 80}}
+        securityContext:
+          privileged: true
+        resources:
+          limits: {cpu: 100m}
+`,
+			want: []string{
+				"error [latest-tag] deployment/app: container app image \"app:latest\" uses the latest tag",
+				"error [latest-tag] deployment/app: container init image \"registry:5000/init\" uses the latest tag",
+				"error [privileged] deployment/app: container app is privileged",
+				"warning [probes] deployment/app: container app has no livenessProbe",
+				"warning [resource-limits] deployment/app: container app has no memory limit",
+			},
+		},
+		{
+			name: "configured rules and required labels",
+			args: []string{"--policy-config", "test/TestPolicy/policy.yaml", "--policy-rule", "latest-tag=warn"},
+			template: `apiVersion: batch/v1
+kind: CronJob
+metadata:
+  name: backup
+  labels:
+    app: backup
+spec:
+  jobTemplate:
+    spec:
+      template:
+        spec:
+          containers:
+          - name: backup
+            image: backup
+`,
+			want: []string{
+				"warning [latest-tag] cronjob/backup: container backup image \"backup\" uses the latest tag",
+				"error [required-labels] cronjob/backup: missing required label team",
+				"error [resource-limits] cronjob/backup: container backup has no cpu limit",
+				"error [resource-limits] cronjob/backup: container backup has no memory limit",
+			},
+		},
+		{
+			name: "exempt rules",
+			template: `apiVersion: v1
+kind: Pod
+metadata:
+  name: debug
+  annotations:
+    kd.homeoffice.gov.uk/policy-exempt: "privileged, probes,resource-limits"
+spec:
+  containers:
+  - name: debug
+    image: debug@sha256:0123
+    securityContext:
+      privileged: true
+`,
+		},
+		{
+			name: "exempt from all rules",
+			args: []string{"--policy-config", "test/TestPolicy/policy.yaml"},
+			template: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+  annotations:
+    kd.homeoffice.gov.uk/policy-exempt: all
+`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			p, err := loadPolicyConfig(newTestContext(policyFlags, c.args))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := &ObjectResource{Template: []byte(c.template)}
+			if err := yaml.Unmarshal(r.Template, r); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range p.Check(r) {
+				got = append(got, f.Severity+" ["+f.Rule+"] "+f.Message)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLoadPolicyConfigInvalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"--policy-rule", "unknown=fail"},
+		{"--policy-rule", "probes=error"},
+		{"--policy-rule", "probes"},
+	} {
+		if _, err := loadPolicyConfig(newTestContext(policyFlags, args)); err == nil {
+			t.Errorf("expected an error for %v", args)
+		}
+	}
+}
+
+func TestCheckUserPolicies(t *testing.T) {
+	policies, err := loadUserPolicies([]string{"test/TestPolicy/policies"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := map[string]interface{}{"minReplicas": 2}
+	cases := []struct {
+		name      string
+		namespace string
+		template  string
+		want      []string
+	}{
+		{
+			name:      "allowed deployment",
+			namespace: "prod",
+			template: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  labels: {team: payments}
+spec:
+  replicas: 2
+`,
+		},
+		{
+			name:      "denied deployment",
+			namespace: "prod",
+			template: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: a-very-long-application-name
+spec:
+  replicas: 1
+  template:
+    spec:
+      hostNetwork: true
+`,
+			want: []string{
+				"error [no-host-network] deployment/a-very-long-application-name: host networking is not allowed",
+				"error [no-host-network] deployment/a-very-long-application-name: failed expression \"object.metadata.name.size() <= 20\"",
+				"warning [prod-replicas] deployment/a-very-long-application-name: production deployments should run the minimum replicas",
+				"error [team-label] deployment/a-very-long-application-name: workloads must have a team label",
+			},
+		},
+		{
+			name:      "policies limited by kind and namespace",
+			namespace: "dev",
+			template: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+`,
+		},
+		{
+			name:      "exempt resource",
+			namespace: "prod",
+			template: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  annotations:
+    kd.homeoffice.gov.uk/policy-exempt: team-label,prod-replicas
+spec:
+  replicas: 1
+`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := &ObjectResource{Template: []byte(c.template)}
+			if err := yaml.Unmarshal(r.Template, r); err != nil {
+				t.Fatal(err)
+			}
+			run := map[string]string{"namespace": c.namespace, "context": "test"}
+			var got []string
+			for _, f := range checkUserPolicies(policies, r, run, config) {
+				got = append(got, f.Severity+" ["+f.Rule+"] "+f.Message)
+			}
+			sort.Strings(got)
+			sort.Strings(c.want)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
+func TestLoadUserPoliciesInvalid(t *testing.T) {
+	env, err := newPolicyEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "policies")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, policy := range []string{
+		"validations:\n- expression: 'true'\n",
+		"name: bad\nvalidations:\n- expression: 'object.'\n",
+		"name: bad\nseverity: error\n",
+		"name: bad\nunknown: field\n",
+	} {
+		f := filepath.Join(dir, "policy.yaml")
+		if err := ioutil.WriteFile(f, []byte(policy), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadUserPolicyFile(env, f); err == nil {
+			t.Errorf("expected an error for policy:\n%s", policy)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// FlagRecordEvents creates kubernetes Events for each deployed resource
+	FlagRecordEvents = "record-events"
+	// FlagAnnotate annotates the deployed resources with who deployed them and when
+	FlagAnnotate = "annotate"
+	// FlagDeployer is who is deploying, recorded in Events and annotations
+	FlagDeployer = "deployer"
+	// FlagPipelineID is the CI pipeline deploying, recorded in Events
+	FlagPipelineID = "pipeline-id"
+
+	// DeployedByAnnotation records who deployed a resource
+	DeployedByAnnotation = "kd.homeoffice.gov.uk/deployed-by"
+	// KdVersionAnnotation records the version of kd which deployed a resource
+	KdVersionAnnotation = "kd.homeoffice.gov.uk/kd-version"
+
+	// EventReasonApplied is the reason of Events for a resource being applied
+	EventReasonApplied = "KdApplied"
+	// EventReasonSucceeded is the reason of Events for a resource deployed successfully
+	EventReasonSucceeded = "KdDeploySucceeded"
+	// EventReasonFailed is the reason of Events for a resource which failed to deploy
+	EventReasonFailed = "KdDeployFailed"
+
+	// EventTypeNormal is the type of Events for successful deployments
+	EventTypeNormal = "Normal"
+	// EventTypeWarning is the type of Events for failed deployments
+	EventTypeWarning = "Warning"
+)
+
+// eventComponent is the source component of the Events kd creates
+const eventComponent = "kd"
+
+// deployAnnotations are the annotations recording a deployment, omitting
+// any which are unknown. When and by which pipeline are only recorded in
+// Events as annotations changing on every run would stop kubectl reporting
+// resources as unchanged.
+func deployAnnotations(c *cli.Context) map[string]string {
+	annotations := map[string]string{}
+	if deployer := c.String(FlagDeployer); deployer != "" {
+		annotations[DeployedByAnnotation] = deployer
+	}
+	if Version != "" {
+		annotations[KdVersionAnnotation] = Version
+	}
+	return annotations
+}
+
+// annotateResource sets annotations in the template of a resource, only
+// editing the annotation lines unless the metadata is in flow style
+func annotateResource(r *ObjectResource, annotations map[string]string) error {
+	if r.Annotations == nil {
+		r.Annotations = map[string]string{}
+	}
+	tmpl, edited := r.Template, true
+	for _, key := range sortedKeys(annotations) {
+		if tmpl, edited = setTemplateValue(tmpl, []string{"metadata", "annotations", key}, annotations[key]); !edited {
+			break
+		}
+	}
+	if edited {
+		for key, value := range annotations {
+			r.Annotations[key] = value
+		}
+		r.Template = tmpl
+		return nil
+	}
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(r.Template, &doc); err != nil {
+		return fmt.Errorf("error annotating %s/%s (from file:%q):%s", r.Kind, r.Name, r.FileName, err)
+	}
+	var meta yaml.MapSlice
+	for _, item := range doc {
+		if item.Key == "metadata" {
+			meta, _ = item.Value.(yaml.MapSlice)
+		}
+	}
+	var existing yaml.MapSlice
+	for _, item := range meta {
+		if item.Key == "annotations" {
+			existing, _ = item.Value.(yaml.MapSlice)
+		}
+	}
+	for _, key := range sortedKeys(annotations) {
+		existing = setMapSliceValue(existing, key, annotations[key])
+		r.Annotations[key] = annotations[key]
+	}
+	meta = setMapSliceValue(meta, "annotations", existing)
+	doc = setMapSliceValue(doc, "metadata", meta)
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	r.Template = b
+	return nil
+}
+
+// sortedKeys gets the keys of a map in order
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// deployMessage describes a deployment for an Event e.g. "configured by
+// alice with kd v1.2.0 (pipeline 42)"
+func deployMessage(c *cli.Context, action string) string {
+	message := action
+	if deployer := c.String(FlagDeployer); deployer != "" {
+		message += " by " + deployer
+	}
+	if Version != "" {
+		message += " with kd " + Version
+	}
+	if id := c.String(FlagPipelineID); id != "" {
+		message += fmt.Sprintf(" (pipeline %s)", id)
+	}
+	return message
+}
+
+// newEvent creates an Event about a deployed resource, the live object
+// provides the uid kubectl describe uses to find the Events of an object
+func newEvent(live map[string]interface{}, reason, eventType, message string, now time.Time) (yaml.MapSlice, string) {
+	meta, _ := toStringMap(live["metadata"])
+	name := fmt.Sprintf("%v", meta["name"])
+	namespace, _ := meta["namespace"].(string)
+	involved := yaml.MapSlice{
+		{Key: "apiVersion", Value: live["apiVersion"]},
+		{Key: "kind", Value: live["kind"]},
+		{Key: "name", Value: name},
+	}
+	if namespace != "" {
+		involved = append(involved, yaml.MapItem{Key: "namespace", Value: namespace})
+	}
+	involved = append(involved, yaml.MapItem{Key: "uid", Value: meta["uid"]})
+	// Events about cluster scoped objects are kept in the default namespace
+	eventNamespace := namespace
+	if eventNamespace == "" {
+		eventNamespace = "default"
+	}
+	timestamp := now.UTC().Format(time.RFC3339)
+	event := yaml.MapSlice{
+		{Key: "apiVersion", Value: "v1"},
+		{Key: "kind", Value: "Event"},
+		{Key: "metadata", Value: yaml.MapSlice{
+			{Key: "generateName", Value: strings.ToLower(name) + "."},
+			{Key: "namespace", Value: eventNamespace},
+		}},
+		{Key: "involvedObject", Value: involved},
+		{Key: "reason", Value: reason},
+		{Key: "message", Value: message},
+		{Key: "type", Value: eventType},
+		{Key: "source", Value: yaml.MapSlice{{Key: "component", Value: eventComponent}}},
+		{Key: "reportingComponent", Value: eventComponent},
+		{Key: "firstTimestamp", Value: timestamp},
+		{Key: "lastTimestamp", Value: timestamp},
+		{Key: "count", Value: 1},
+	}
+	return event, eventNamespace
+}
+
+// recordEvent creates an Event about a resource when --record-events is
+// set, failing to record an Event is logged but doesn't fail the deployment.
+// The live object is only fetched for the first Event about a resource.
+func recordEvent(c *cli.Context, r *ObjectResource, reason, eventType, message string) {
+	if !c.Bool(FlagRecordEvents) || r.Kind == "" || r.Name == "" {
+		return
+	}
+	if r.live == nil {
+		live, err := NewK8ApiKubectl(c).Get(r.Namespace, r.Kind, r.Name)
+		if err != nil {
+			logDebug.Printf("not recording %s event for %s/%s:%s", reason, r.Kind, r.Name, err)
+			return
+		}
+		r.live = live
+	}
+	event, namespace := newEvent(r.live, reason, eventType, redact(message), time.Now())
+	data, err := yaml.Marshal(event)
+	if err != nil {
+		logError.Printf("error creating %s event for %s/%s:%s", reason, r.Kind, r.Name, err)
+		return
+	}
+	// The namespace of the event takes precedence over --namespace
+	cmd, err := newKubeCmd(c, []string{"create", "-f", "-", "--namespace=" + namespace}, false)
+	if err != nil {
+		logError.Printf("error creating %s event for %s/%s:%s", reason, r.Kind, r.Name, err)
+		return
+	}
+	var errbuf bytes.Buffer
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stderr = &errbuf
+	if err := cmd.Run(); err != nil {
+		if errbuf.Len() > 0 {
+			err = fmt.Errorf("%s", redact(strings.TrimSpace(errbuf.String())))
+		}
+		logError.Printf("error creating %s event for %s/%s:%s", reason, r.Kind, r.Name, err)
+		return
+	}
+	logDebug.Printf("recorded %s event for %s/%s", reason, r.Kind, r.Name)
+}
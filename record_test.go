@@ -0,0 +1,202 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// recordFlags are the global flags used to record deployments
+func recordFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringFlag{Name: FlagDeployer},
+		cli.StringFlag{Name: FlagPipelineID},
+	}
+}
+
+func TestDeployAnnotations(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+	Version = "v1.2.0"
+
+	cases := []struct {
+		name string
+		args []string
+		want map[string]string
+	}{
+		{
+			name: "Check all annotations are set",
+			args: []string{"--" + FlagDeployer, "alice", "--" + FlagPipelineID, "42"},
+			want: map[string]string{
+				DeployedByAnnotation: "alice",
+				KdVersionAnnotation:  "v1.2.0",
+			},
+		},
+		{
+			name: "Check unknown values are omitted",
+			want: map[string]string{
+				KdVersionAnnotation: "v1.2.0",
+			},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := deployAnnotations(newTestContext(recordFlags(), c.args))
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
+func TestAnnotateResource(t *testing.T) {
+	annotations := map[string]string{
+		DeployedByAnnotation: "alice",
+		KdVersionAnnotation:  "v1.2.0",
+	}
+	cases := []struct {
+		name     string
+		template string
+		want     string
+	}{
+		{
+			name:     "Check existing annotations are kept",
+			template: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n  annotations:\n    owner: team\ndata:\n  a: b\n",
+			want: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n  annotations:\n    owner: team\n" +
+				"    kd.homeoffice.gov.uk/deployed-by: alice\n    kd.homeoffice.gov.uk/kd-version: v1.2.0\ndata:\n  a: b\n",
+		},
+		{
+			name:     "Check annotations are added without metadata annotations",
+			template: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n",
+			want: "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: app\n  annotations:\n" +
+				"    kd.homeoffice.gov.uk/deployed-by: alice\n    kd.homeoffice.gov.uk/kd-version: v1.2.0\n",
+		},
+		{
+			name:     "Check comments and block scalars are kept",
+			template: "kind: ConfigMap\nmetadata:\n  name: app # the app\n  annotations:\n    kd.homeoffice.gov.uk/deployed-by: bob\ndata:\n  run.sh: |\n    #!/bin/sh\n    exec app\n",
+			want: "kind: ConfigMap\nmetadata:\n  name: app # the app\n  annotations:\n    kd.homeoffice.gov.uk/deployed-by: alice\n" +
+				"    kd.homeoffice.gov.uk/kd-version: v1.2.0\ndata:\n  run.sh: |\n    #!/bin/sh\n    exec app\n",
+		},
+		{
+			name:     "Check JSON is annotated",
+			template: "{\n  \"kind\": \"ConfigMap\",\n  \"metadata\": {\n    \"name\": \"app\"\n  }\n}\n",
+			want: "kind: ConfigMap\nmetadata:\n  name: app\n  annotations:\n" +
+				"    kd.homeoffice.gov.uk/deployed-by: alice\n    kd.homeoffice.gov.uk/kd-version: v1.2.0\n",
+		},
+		{
+			name:     "Check flow style metadata is annotated",
+			template: "kind: ConfigMap\nmetadata: {name: app}\n",
+			want: "kind: ConfigMap\nmetadata:\n  name: app\n  annotations:\n" +
+				"    kd.homeoffice.gov.uk/deployed-by: alice\n    kd.homeoffice.gov.uk/kd-version: v1.2.0\n",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := &ObjectResource{Kind: "ConfigMap", ObjectMeta: ObjectMeta{Name: "app"}, Template: []byte(c.template)}
+			if err := annotateResource(r, annotations); err != nil {
+				t.Fatal(err)
+			}
+			if string(r.Template) != c.want {
+				t.Errorf("got:\n%s\nwant:\n%s", r.Template, c.want)
+			}
+			if r.Annotations[DeployedByAnnotation] != "alice" {
+				t.Errorf("expected the resource annotations to be updated, got: %v", r.Annotations)
+			}
+		})
+	}
+}
+
+func TestDeployMessage(t *testing.T) {
+	defer func(v string) { Version = v }(Version)
+	Version = "v1.2.0"
+	ctx := newTestContext(recordFlags(), []string{"--" + FlagDeployer, "alice", "--" + FlagPipelineID, "42"})
+	if got, want := deployMessage(ctx, "configured"), "configured by alice with kd v1.2.0 (pipeline 42)"; got != want {
+		t.Errorf("got: %q\nwant: %q\n", got, want)
+	}
+}
+
+func TestNewEvent(t *testing.T) {
+	now := time.Date(2026, 10, 18, 9, 12, 0, 0, time.UTC)
+	cases := []struct {
+		name      string
+		live      string
+		namespace string
+		want      string
+	}{
+		{
+			name:      "Check the event is about the live object",
+			live:      "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: App\n  namespace: dev\n  uid: 1234\n",
+			namespace: "dev",
+			want: `apiVersion: v1
+kind: Event
+metadata:
+  generateName: app.
+  namespace: dev
+involvedObject:
+  apiVersion: apps/v1
+  kind: Deployment
+  name: App
+  namespace: dev
+  uid: 1234
+reason: KdApplied
+message: configured by alice
+type: Normal
+source:
+  component: kd
+reportingComponent: kd
+firstTimestamp: "2026-10-18T09:12:00Z"
+lastTimestamp: "2026-10-18T09:12:00Z"
+count: 1
+`,
+		},
+		{
+			name:      "Check cluster scoped events are in the default namespace",
+			live:      "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: dev\n  uid: 5678\n",
+			namespace: "default",
+			want: `apiVersion: v1
+kind: Event
+metadata:
+  generateName: dev.
+  namespace: default
+involvedObject:
+  apiVersion: v1
+  kind: Namespace
+  name: dev
+  uid: 5678
+reason: KdApplied
+message: configured by alice
+type: Normal
+source:
+  component: kd
+reportingComponent: kd
+firstTimestamp: "2026-10-18T09:12:00Z"
+lastTimestamp: "2026-10-18T09:12:00Z"
+count: 1
+`,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			live, err := decodeTemplate([]byte(c.live))
+			if err != nil {
+				t.Fatal(err)
+			}
+			event, namespace := newEvent(live, EventReasonApplied, EventTypeNormal, "configured by alice", now)
+			if namespace != c.namespace {
+				t.Errorf("got namespace: %s, want: %s", namespace, c.namespace)
+			}
+			got, err := yaml.Marshal(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != c.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, c.want)
+			}
+		})
+	}
+}
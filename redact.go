@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/base64"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// RedactedValue is written in place of any sensitive value
+	RedactedValue = "***"
+	// redactMinLength is the shortest value masked in free text, shorter values
+	// would mask unrelated output (e.g. "1" or "no")
+	redactMinLength = 4
+	// redactDefaultMinLength is the shortest environment variable value masked
+	// by the loose default patterns, which may match settings as well as secrets
+	redactDefaultMinLength = 8
+)
+
+var (
+	// sensitiveValues holds every value which must never reach a logger
+	sensitiveValues = newRedactor()
+
+	// sensitiveArgs matches kubectl auth flags set in newKubeCmdSub
+	sensitiveArgs = regexp.MustCompile(`(--(?:token|password)=)\S+`)
+
+	// defaultRedactEnvPatterns are the environment variable names masked when
+	// no patterns are specified
+	defaultRedactEnvPatterns = []string{"*PASSWORD*", "*TOKEN*", "*SECRET*"}
+
+	// looseRedactEnvPatterns are the environment variable names also masked
+	// when no patterns are specified, but only for values which look secret
+	// as they also match settings e.g. FEATURE_KEY=true
+	looseRedactEnvPatterns = []string{"*_KEY"}
+)
+
+// redactor is a registry of sensitive values to mask
+type redactor struct {
+	sync.RWMutex
+	values []string
+}
+
+func newRedactor() *redactor {
+	return &redactor{}
+}
+
+// Add registers a value as sensitive
+func (r *redactor) Add(v string) {
+	v = strings.TrimSpace(v)
+	if len(v) < redactMinLength {
+		return
+	}
+	r.Lock()
+	defer r.Unlock()
+	for _, existing := range r.values {
+		if existing == v {
+			return
+		}
+	}
+	r.values = append(r.values, v)
+	// Longest first so a value containing another is masked whole
+	sort.Slice(r.values, func(i, j int) bool {
+		return len(r.values[i]) > len(r.values[j])
+	})
+}
+
+// Redact masks all registered values and auth flags in a string
+func (r *redactor) Redact(s string) string {
+	r.RLock()
+	defer r.RUnlock()
+	for _, v := range r.values {
+		s = strings.Replace(s, v, RedactedValue, -1)
+	}
+	return sensitiveArgs.ReplaceAllString(s, "${1}"+RedactedValue)
+}
+
+// redactWriter masks sensitive values before writing to the wrapped writer
+type redactWriter struct {
+	w io.Writer
+}
+
+// Write will redact a log entry (log.Logger calls Write once per entry)
+func (rw redactWriter) Write(p []byte) (int, error) {
+	if _, err := rw.w.Write([]byte(sensitiveValues.Redact(string(p)))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// redact masks sensitive values in a string
+func redact(s string) string {
+	return sensitiveValues.Redact(s)
+}
+
+// redactArgs masks sensitive values in a list of command arguments
+func redactArgs(args []string) string {
+	return redact(strings.Join(args, " "))
+}
+
+// setupRedaction registers sensitive flag values and environment variables
+func setupRedaction(c *cli.Context) {
+	for _, flag := range []string{"kube-token", "kube-password", FlagKubeConfigData, FlagCaData} {
+		if c.IsSet(flag) {
+			sensitiveValues.Add(c.String(flag))
+		}
+	}
+	// Webhook urls usually include a token
+	for _, url := range c.StringSlice(FlagWebhook) {
+		sensitiveValues.Add(url)
+	}
+	patterns, loose := defaultRedactEnvPatterns, looseRedactEnvPatterns
+	if c.IsSet(FlagRedactEnv) {
+		patterns, loose = c.StringSlice(FlagRedactEnv), nil
+	}
+	for k, v := range EnvToMap() {
+		if !matchesAny(k, patterns) {
+			if !matchesAny(k, loose) {
+				continue
+			}
+			if !looksSecret(v) {
+				logDebug.Printf("not masking value of environment variable %s, it doesn't look secret", k)
+				continue
+			}
+		}
+		logDebug.Printf("masking value of environment variable %s", k)
+		sensitiveValues.Add(v)
+	}
+}
+
+// looksSecret reports if a value could be a secret rather than a setting,
+// i.e. it is long enough and isn't a boolean or a number
+func looksSecret(v string) bool {
+	v = strings.TrimSpace(v)
+	if len(v) < redactDefaultMinLength {
+		return false
+	}
+	if _, err := strconv.ParseBool(v); err == nil {
+		return false
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return false
+	}
+	return true
+}
+
+// matchesAny reports if a name matches any of the glob patterns
+func matchesAny(name string, patterns []string) bool {
+	for _, p := range patterns {
+		if matched, _ := path.Match(p, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// redactTemplate registers the values of a Secret's data and stringData and
+// returns the template with those values masked
+func redactTemplate(tmpl []byte) string {
+	var doc map[interface{}]interface{}
+	if err := yaml.Unmarshal(tmpl, &doc); err != nil || doc["kind"] != "Secret" {
+		return redact(string(tmpl))
+	}
+	for _, key := range []string{"data", "stringData"} {
+		values, ok := doc[key].(map[interface{}]interface{})
+		if !ok {
+			continue
+		}
+		for k, v := range values {
+			if s, ok := v.(string); ok {
+				sensitiveValues.Add(s)
+				if decoded, err := base64.StdEncoding.DecodeString(s); err == nil && key == "data" {
+					sensitiveValues.Add(string(decoded))
+				}
+			}
+			values[k] = RedactedValue
+		}
+	}
+	masked, err := yaml.Marshal(doc)
+	if err != nil {
+		return redact(string(tmpl))
+	}
+	return redact(string(masked))
+}
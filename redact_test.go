@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestRedactArgs(t *testing.T) {
+	cases := []struct {
+		name  string
+		input []string
+		want  string
+	}{
+		{
+			name:  "Check token flag is masked",
+			input: []string{"kubectl", "--token=abc123def", "apply", "-f", "-"},
+			want:  "kubectl --token=*** apply -f -",
+		},
+		{
+			name:  "Check password flag is masked",
+			input: []string{"kubectl", "--username=bob", "--password=hunter2", "get", "po"},
+			want:  "kubectl --username=bob --password=*** get po",
+		},
+		{
+			name:  "Check other flags are untouched",
+			input: []string{"kubectl", "--namespace=test", "get", "po"},
+			want:  "kubectl --namespace=test get po",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := redactArgs(c.input)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	cases := []struct {
+		name   string
+		values []string
+		input  string
+		want   string
+	}{
+		{
+			name:   "Check registered value is masked",
+			values: []string{"s3cr3tvalue"},
+			input:  "error: s3cr3tvalue is invalid",
+			want:   "error: *** is invalid",
+		},
+		{
+			name:   "Check longest value is masked first",
+			values: []string{"s3cr3t", "s3cr3tvalue"},
+			input:  "s3cr3tvalue and s3cr3t",
+			want:   "*** and ***",
+		},
+		{
+			name:   "Check short values are not masked",
+			values: []string{"no"},
+			input:  "no change",
+			want:   "no change",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := newRedactor()
+			for _, v := range c.values {
+				r.Add(v)
+			}
+			got := r.Redact(c.input)
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
+func TestRedactTemplate(t *testing.T) {
+	tmpl := "kind: Secret\nmetadata:\n  name: test\ndata:\n  password: aHVudGVyMjIy\nstringData:\n  token: plaintoken\n"
+	got := redactTemplate([]byte(tmpl))
+	for _, leaked := range []string{"aHVudGVyMjIy", "plaintoken"} {
+		if strings.Contains(got, leaked) {
+			t.Errorf("expected %q to be masked in:\n%s", leaked, got)
+		}
+	}
+	if !strings.Contains(got, "name: test") {
+		t.Errorf("expected metadata to be preserved in:\n%s", got)
+	}
+
+	// Values should also be masked when written by any logger
+	var b bytes.Buffer
+	l := log.New(redactWriter{&b}, "", 0)
+	l.Printf("kubectl error: hunter222 plaintoken")
+	if got := b.String(); got != "kubectl error: *** ***\n" {
+		t.Errorf("got: %#v\nwant: %#v\n", got, "kubectl error: *** ***\n")
+	}
+}
+
+func TestSetupRedaction(t *testing.T) {
+	defer func(r *redactor) { sensitiveValues = r }(sensitiveValues)
+	os.Setenv("KD_TEST_FEATURE_KEY", "true")
+	os.Setenv("KD_TEST_CACHE_KEY", "12345678")
+	os.Setenv("KD_TEST_API_KEY", "s3cr3tapikey")
+	os.Setenv("KD_TEST_DB_PASSWORD", "87654321")
+	defer os.Unsetenv("KD_TEST_FEATURE_KEY")
+	defer os.Unsetenv("KD_TEST_CACHE_KEY")
+	defer os.Unsetenv("KD_TEST_API_KEY")
+	defer os.Unsetenv("KD_TEST_DB_PASSWORD")
+
+	cases := []struct {
+		name  string
+		args  []string
+		input string
+		want  string
+	}{
+		{
+			name:  "Check *_KEY values are only masked when they look secret",
+			input: "enabled: true cache: 12345678 key: s3cr3tapikey",
+			want:  "enabled: true cache: 12345678 key: ***",
+		},
+		{
+			name:  "Check numeric passwords are masked",
+			input: "password: 87654321 cache: 12345678",
+			want:  "password: *** cache: 12345678",
+		},
+		{
+			name:  "Check values matching set patterns are always masked",
+			args:  []string{"--" + FlagRedactEnv, "KD_TEST_FEATURE_KEY"},
+			input: "enabled: true key: s3cr3tapikey",
+			want:  "enabled: *** key: s3cr3tapikey",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sensitiveValues = newRedactor()
+			setupRedaction(newTestContext([]cli.Flag{cli.StringSliceFlag{Name: FlagRedactEnv}}, c.args))
+			if got := redact(c.input); got != c.want {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
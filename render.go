@@ -23,27 +23,8 @@ var (
 // Render - the function used for rendering templates (with Sprig support)
 func Render(k K8Api, tmpl string, vars interface{}) (string, bool, error) {
 
-	// Must cast interface back to map[string]{interface} to work with
-	// helm function ToYAML
-	fm := sprig.TxtFuncMap()
-	// Preserve old KD functionality (strings param order vs sprig)
-	fm["contains"] = strings.Contains
-	fm["hasPrefix"] = strings.HasPrefix
-	fm["hasSuffix"] = strings.HasSuffix
-	fm["split"] = strings.Split
-	fm["secret"] = secret
-	// Add file function to map
-	fm["file"] = fileRender
-	fm["fileWith"] = fileRenderWithData
 	// Required for lookup function
 	k8Api = k
-	fm["k8lookup"] = k8lookup
-	// Added some oft used helm functions
-	fm["toToml"] = chartutil.ToYaml
-	fm["toYaml"] = toYaml
-	fm["fromYaml"] = chartutil.FromYaml
-	fm["toJson"] = chartutil.ToJson
-	fm["fromJson"] = chartutil.FromJson
 
 	secretUsed = false
 	defer func() {
@@ -51,7 +32,7 @@ func Render(k K8Api, tmpl string, vars interface{}) (string, bool, error) {
 			logError.Fatal(err)
 		}
 	}()
-	t := template.Must(template.New("template").Funcs(fm).Parse(tmpl))
+	t := template.Must(template.New("template").Funcs(funcMap()).Parse(tmpl))
 	if allowMissingVariables {
 		t.Option("missingkey=default")
 	} else {
@@ -65,6 +46,36 @@ func Render(k K8Api, tmpl string, vars interface{}) (string, bool, error) {
 	return strings.Replace(b.String(), "\n\n", "\n", -1), secretUsed, nil
 }
 
+// funcMap - all the functions available to templates
+func funcMap() template.FuncMap {
+	// Must cast interface back to map[string]{interface} to work with
+	// helm function ToYAML
+	fm := sprig.TxtFuncMap()
+	// Preserve old KD functionality (strings param order vs sprig)
+	fm["contains"] = strings.Contains
+	fm["hasPrefix"] = strings.HasPrefix
+	fm["hasSuffix"] = strings.HasSuffix
+	fm["split"] = strings.Split
+	fm["secret"] = secret
+	// Add file function to map
+	fm["file"] = fileRender
+	fm["fileWith"] = fileRenderWithData
+	// Lookup functions use the K8Api set by Render
+	fm["k8lookup"] = k8lookup
+	fm["k8lookupIn"] = k8lookupIn
+	fm["k8lookupDefault"] = k8lookupDefault
+	fm["k8object"] = k8object
+	fm["k8objectDefault"] = k8objectDefault
+	fm["k8list"] = k8list
+	// Added some oft used helm functions
+	fm["toToml"] = chartutil.ToYaml
+	fm["toYaml"] = toYaml
+	fm["fromYaml"] = chartutil.FromYaml
+	fm["toJson"] = chartutil.ToJson
+	fm["fromJson"] = chartutil.FromJson
+	return fm
+}
+
 // secret generate a secret
 func secret(stringType string, length int) string {
 	var (
@@ -101,8 +112,11 @@ func secret(stringType string, length int) string {
 	}
 	// Need to assign this to prevent compiler problem
 	secretUsed = true
-	// lastly return the base64 encoded version
-	return base64.StdEncoding.EncodeToString(buf)
+	// lastly return the base64 encoded version (never to be logged)
+	encoded := base64.StdEncoding.EncodeToString(buf)
+	sensitiveValues.Add(string(buf))
+	sensitiveValues.Add(encoded)
+	return encoded
 }
 
 func fileRenderWithData(key string, extra map[string]interface{}) string {
@@ -135,6 +149,59 @@ func k8lookup(kind, name, path string) string {
 	return data
 }
 
+// k8lookupIn find a value from a kubernetes object in another namespace
+func k8lookupIn(namespace, kind, name, path string) string {
+	data, err := k8Api.LookupNamespace(namespace, kind, name, path)
+	if err != nil {
+		panic(err.Error())
+	}
+	return data
+}
+
+// k8lookupDefault find a value from a kubernetes object or a default when the
+// object does not exist
+func k8lookupDefault(kind, name, path, def string) string {
+	data, err := k8Api.Lookup(kind, name, path)
+	if isNotFound(err) {
+		return def
+	}
+	if err != nil {
+		panic(err.Error())
+	}
+	return data
+}
+
+// k8object find a kubernetes object (namespace "" for the current namespace)
+func k8object(namespace, kind, name string) map[string]interface{} {
+	obj, err := k8Api.Get(namespace, kind, name)
+	if err != nil {
+		panic(err.Error())
+	}
+	return obj
+}
+
+// k8objectDefault find a kubernetes object or a default when the object does
+// not exist
+func k8objectDefault(namespace, kind, name string, def interface{}) interface{} {
+	obj, err := k8Api.Get(namespace, kind, name)
+	if isNotFound(err) {
+		return def
+	}
+	if err != nil {
+		panic(err.Error())
+	}
+	return obj
+}
+
+// k8list find all kubernetes objects of a kind matching a label selector
+func k8list(namespace, kind, selector string) []interface{} {
+	items, err := k8Api.List(namespace, kind, selector)
+	if err != nil {
+		panic(err.Error())
+	}
+	return items
+}
+
 // Copied the function from helm but use the golang yaml parser
 // as it's compatible with the generic map[insterface{}]interface{} types
 // we cope with here
@@ -5,7 +5,10 @@ import (
 	"io/ioutil"
 	"log"
 	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/urfave/cli"
 )
 
 var emptymap map[string]string
@@ -118,3 +121,123 @@ func TestRenderMissingVariablesAllowed(t *testing.T) {
 	})
 	allowMissingVariables = false
 }
+
+// stubK8Api is a K8Api serving a fixed set of objects keyed by namespace/kind/name
+type stubK8Api struct {
+	K8ApiNoop
+	objects map[string]map[string]interface{}
+	// err is returned by Get for all objects when set
+	err error
+}
+
+func (a stubK8Api) Get(namespace, kind, name string) (map[string]interface{}, error) {
+	if a.err != nil {
+		return nil, a.err
+	}
+	if obj, ok := a.objects[namespace+"/"+kind+"/"+name]; ok {
+		return obj, nil
+	}
+	return nil, NotFoundError{Kind: kind, Name: name}
+}
+
+func (a stubK8Api) Lookup(kind, name, path string) (string, error) {
+	if _, err := a.Get("", kind, name); err != nil {
+		return "", err
+	}
+	return "found", nil
+}
+
+func (a stubK8Api) List(namespace, kind, selector string) ([]interface{}, error) {
+	var items []interface{}
+	for _, obj := range a.objects {
+		if obj["kind"] == kind {
+			items = append(items, obj)
+		}
+	}
+	return items, nil
+}
+
+func TestRenderLookups(t *testing.T) {
+	api := stubK8Api{objects: map[string]map[string]interface{}{
+		"other/ConfigMap/shared": {
+			"kind":     "ConfigMap",
+			"metadata": map[string]interface{}{"name": "shared"},
+			"data":     map[string]interface{}{"host": "db.other.svc"},
+		},
+	}}
+
+	cases := []struct {
+		name      string
+		inputdata string
+		want      string
+	}{
+		{
+			name:      "Check k8object returns structured data",
+			inputdata: `{{ (k8object "other" "ConfigMap" "shared").data.host }}`,
+			want:      "db.other.svc",
+		},
+		{
+			name:      "Check k8objectDefault returns the default when absent",
+			inputdata: `{{ (k8objectDefault "" "ConfigMap" "missing" (dict "data" (dict "host" "localhost"))).data.host }}`,
+			want:      "localhost",
+		},
+		{
+			name:      "Check k8list can be ranged over",
+			inputdata: `{{ range k8list "" "ConfigMap" "" }}{{ .metadata.name }}{{ end }}`,
+			want:      "shared",
+		},
+		{
+			name:      "Check k8lookupDefault returns the default when absent",
+			inputdata: `{{ k8lookupDefault "pv" "missing" ".spec.capacity.storage" "10Gi" }}`,
+			want:      "10Gi",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, _, err := Render(api, c.inputdata, emptymap)
+			if err != nil {
+				t.Errorf("unexpected error rendering: %s", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+
+	t.Run("Check k8lookup errors when the object is absent", func(t *testing.T) {
+		_, _, err := Render(api, `{{ k8lookup "pv" "missing" ".spec" }}`, emptymap)
+		if err == nil {
+			t.Errorf("expected an error for a missing object")
+		}
+	})
+}
+
+func TestRenderResourcesTypeErrors(t *testing.T) {
+	defer func(d bool) { dryRun = d }(dryRun)
+	dryRun = true
+	cases := []struct {
+		name      string
+		args      []string
+		wantError string
+	}{
+		{
+			name:      "Check type errors name the file",
+			wantError: `error parsing deployment/app (from file:"test/TestValidate/type-error.yaml")`,
+		},
+		{
+			name:      "Check type errors are reported by validation",
+			args:      []string{"--" + FlagValidate},
+			wantError: "1 schema validation errors found",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ctx := newTestContext([]cli.Flag{cli.BoolFlag{Name: FlagValidate}}, c.args)
+			_, err := renderResources(ctx, map[string]interface{}{}, []string{"test/TestValidate/type-error.yaml"})
+			if err == nil || !strings.HasPrefix(err.Error(), c.wantError) {
+				t.Errorf("got error: %v\nwant: %s", err, c.wantError)
+			}
+		})
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// FlagReport writes a report of the deployment to files, JUnit XML for files
+// ending .xml otherwise JSON
+const FlagReport = "report"
+
+const (
+	// ActionSkippedCreateOnly is the action for create only resources which exist
+	ActionSkippedCreateOnly = "skipped-create-only"
+	// ActionSkippedNotFound is the action for deleting resources which don't exist
+	ActionSkippedNotFound = "skipped-not-found"
+	// ActionDryRun is the action for resources rendered in a dry run
+	ActionDryRun = "dry-run"
+	// ActionFailed is the action for resources kubectl failed to deploy
+	ActionFailed = "failed"
+	// ActionPending is the action for resources about to be deployed
+	ActionPending = "pending"
+	// ActionNotDeployed is the action for resources not reached due to an
+	// earlier error
+	ActionNotDeployed = "not-deployed"
+
+	// RolloutComplete is the rollout result of resources which became ready
+	RolloutComplete = "complete"
+	// RolloutTimeout is the rollout result of resources which weren't ready in time
+	RolloutTimeout = "timeout"
+	// RolloutFailed is the rollout result of resources which failed to become ready
+	RolloutFailed = "failed"
+)
+
+// ResourceResult is the outcome of deploying a resource
+type ResourceResult struct {
+	// Action is the action taken as reported by kubectl e.g. created,
+	// configured, unchanged or deleted, or why the resource was skipped
+	Action string
+	// Rollout is the result of watching the resource become ready
+	Rollout string
+	// TimeToReady is the time taken from deploying the resource to it being ready
+	TimeToReady time.Duration
+	// Error is the error deploying the resource
+	Error string
+}
+
+// DeployReport is the machine-readable report of a run
+type DeployReport struct {
+	Started   time.Time        `json:"started"`
+	Finished  time.Time        `json:"finished"`
+	Success   bool             `json:"success"`
+	Error     string           `json:"error,omitempty"`
+	Resources []ResourceReport `json:"resources"`
+}
+
+// ResourceReport is the report of a resource, TimeToReady is in seconds
+type ResourceReport struct {
+	Kind        string  `json:"kind"`
+	Name        string  `json:"name"`
+	Namespace   string  `json:"namespace,omitempty"`
+	File        string  `json:"file"`
+	Action      string  `json:"action"`
+	Rollout     string  `json:"rollout,omitempty"`
+	TimeToReady float64 `json:"timeToReady,omitempty"`
+	Error       string  `json:"error,omitempty"`
+}
+
+// newDeployReport creates the report of the resources and any error ending
+// the run
+func newDeployReport(started time.Time, resources []*ObjectResource, err error) *DeployReport {
+	report := &DeployReport{
+		Started:   started,
+		Finished:  time.Now(),
+		Success:   err == nil,
+		Resources: []ResourceReport{},
+	}
+	if err != nil {
+		report.Error = redact(err.Error())
+	}
+	for _, r := range resources {
+		action := r.Result.Action
+		if action == "" {
+			action = ActionNotDeployed
+		}
+		report.Resources = append(report.Resources, ResourceReport{
+			Kind:        r.Kind,
+			Name:        r.Name,
+			Namespace:   r.Namespace,
+			File:        r.FileName,
+			Action:      action,
+			Rollout:     r.Result.Rollout,
+			TimeToReady: r.Result.TimeToReady.Seconds(),
+			Error:       redact(r.Result.Error),
+		})
+	}
+	return report
+}
+
+// writeReports writes the report of a run to each of the report files
+func writeReports(c *cli.Context, started time.Time, resources []*ObjectResource, runErr error) error {
+	files := c.StringSlice(FlagReport)
+	if len(files) == 0 {
+		return nil
+	}
+	report := newDeployReport(started, resources, runErr)
+	for _, fn := range files {
+		var data []byte
+		var err error
+		if strings.EqualFold(filepath.Ext(fn), ".xml") {
+			data, err = report.JUnit()
+		} else {
+			data, err = json.MarshalIndent(report, "", "  ")
+		}
+		if err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(fn, append(data, '\n'), 0644); err != nil {
+			return fmt.Errorf("error writing report '%s':%s", fn, err)
+		}
+		logInfo.Printf("wrote report to %s", fn)
+	}
+	return nil
+}
+
+// junitTestSuite is a JUnit XML test suite, with a test case per resource
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnit renders the report as JUnit XML, resources not deployed due to an
+// error are failures and those skipped are reported as skipped
+func (d *DeployReport) JUnit() ([]byte, error) {
+	suite := junitTestSuite{
+		Name:      "kd",
+		Tests:     len(d.Resources),
+		Time:      fmt.Sprintf("%.3f", d.Finished.Sub(d.Started).Seconds()),
+		Timestamp: d.Started.UTC().Format(time.RFC3339),
+	}
+	for _, r := range d.Resources {
+		name := strings.ToLower(r.Kind) + "/" + r.Name
+		if r.Namespace != "" {
+			name = r.Namespace + "/" + name
+		}
+		tc := junitTestCase{
+			ClassName: r.File,
+			Name:      name,
+			Time:      fmt.Sprintf("%.3f", r.TimeToReady),
+			SystemOut: fmt.Sprintf("action: %s", r.Action),
+		}
+		if r.Rollout != "" {
+			tc.SystemOut += fmt.Sprintf("\nrollout: %s", r.Rollout)
+		}
+		switch {
+		case r.Error != "":
+			tc.Failure = &junitMessage{Message: r.Action, Text: r.Error}
+			suite.Failures++
+		case r.Action == ActionNotDeployed && !d.Success:
+			tc.Failure = &junitMessage{Message: r.Action, Text: "not deployed due to an earlier error"}
+			suite.Failures++
+		case strings.HasPrefix(r.Action, "skipped") || r.Action == ActionDryRun:
+			tc.Skipped = &junitMessage{Message: r.Action}
+			suite.Skipped++
+		}
+		suite.TestCases = append(suite.TestCases, tc)
+	}
+	data, err := xml.MarshalIndent(suite, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
+
+// kubectlAction gets the action kubectl reports it took on a resource from
+// the line of output about it e.g. "deployment.apps/app configured (server
+// dry run)" is configured. Other lines (e.g. from --prune) are ignored.
+func kubectlAction(r *ObjectResource, out, command string) string {
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !isKubectlRef(r, fields[0]) {
+			continue
+		}
+		// Drop any qualifiers e.g. "(dry run)"
+		action := strings.Join(fields[1:], " ")
+		for strings.HasSuffix(action, ")") && strings.Contains(action, "(") {
+			action = strings.TrimSpace(action[:strings.LastIndex(action, "(")])
+		}
+		if words := strings.Fields(action); len(words) > 0 {
+			return words[len(words)-1]
+		}
+	}
+	return command
+}
+
+// isKubectlRef reports if a kind.group/name reference in kubectl output is
+// to a resource, matching a generated name by its prefix
+func isKubectlRef(r *ObjectResource, ref string) bool {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	kind := strings.ToLower(r.Kind)
+	if parts[0] != kind && !strings.HasPrefix(parts[0], kind+".") {
+		return false
+	}
+	if r.Name == "" && r.GenerateName != "" {
+		return strings.HasPrefix(parts[1], r.GenerateName)
+	}
+	return parts[1] == r.Name
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+func TestKubectlAction(t *testing.T) {
+	app := &ObjectResource{Kind: "Deployment", ObjectMeta: ObjectMeta{Name: "app"}}
+	cases := []struct {
+		name     string
+		resource *ObjectResource
+		out      string
+		command  string
+		want     string
+	}{
+		{
+			name:     "Check configured is reported",
+			resource: app,
+			out:      "deployment.apps/app configured\n",
+			command:  "apply",
+			want:     "configured",
+		},
+		{
+			name:     "Check unchanged is reported",
+			resource: &ObjectResource{Kind: "Service", ObjectMeta: ObjectMeta{Name: "app"}},
+			out:      "service/app unchanged\n",
+			command:  "apply",
+			want:     "unchanged",
+		},
+		{
+			name:     "Check dry run qualifiers are dropped",
+			resource: app,
+			out:      "deployment.apps/app configured (server dry run)\n",
+			command:  "apply",
+			want:     "configured",
+		},
+		{
+			name:     "Check pruned resources are ignored",
+			resource: app,
+			out:      "deployment.apps/app created\nconfigmap/old pruned\ndeployment.apps/old pruned\n",
+			command:  "apply",
+			want:     "created",
+		},
+		{
+			name:     "Check generated names are matched",
+			resource: &ObjectResource{Kind: "Job", ObjectMeta: ObjectMeta{GenerateName: "migrate-"}},
+			out:      "job.batch/migrate-x7k2p created\n",
+			command:  "create",
+			want:     "created",
+		},
+		{
+			name:     "Check the command is used without output",
+			resource: app,
+			out:      "",
+			command:  "replace",
+			want:     "replace",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := kubectlAction(c.resource, c.out, c.command); got != c.want {
+				t.Errorf("got: %q\nwant: %q\n", got, c.want)
+			}
+		})
+	}
+}
+
+// reportResources are resources in each state a run can leave them in
+func reportResources() []*ObjectResource {
+	return []*ObjectResource{
+		{
+			Kind:       "Deployment",
+			ObjectMeta: ObjectMeta{Name: "app", Namespace: "dev"},
+			FileName:   "app.yaml",
+			Result:     ResourceResult{Action: "configured", Rollout: RolloutComplete, TimeToReady: 2500 * time.Millisecond},
+		},
+		{
+			Kind:       "ConfigMap",
+			ObjectMeta: ObjectMeta{Name: "settings", Namespace: "dev"},
+			FileName:   "config.yaml",
+			Result:     ResourceResult{Action: ActionSkippedCreateOnly},
+		},
+		{
+			Kind:       "Job",
+			ObjectMeta: ObjectMeta{Name: "migrate", Namespace: "dev"},
+			FileName:   "job.yaml",
+			Result:     ResourceResult{Action: "created", Rollout: RolloutTimeout, Error: "Job \"migrate\" rolling update timed out"},
+		},
+		{
+			Kind:       "Service",
+			ObjectMeta: ObjectMeta{Name: "app", Namespace: "dev"},
+			FileName:   "app.yaml",
+		},
+	}
+}
+
+func TestNewDeployReport(t *testing.T) {
+	started := time.Now()
+	report := newDeployReport(started, reportResources(), errors.New("Job \"migrate\" rolling update timed out"))
+	if report.Success || report.Error == "" {
+		t.Errorf("expected a failed report, got success %t error %q", report.Success, report.Error)
+	}
+	want := []ResourceReport{
+		{Kind: "Deployment", Name: "app", Namespace: "dev", File: "app.yaml", Action: "configured", Rollout: RolloutComplete, TimeToReady: 2.5},
+		{Kind: "ConfigMap", Name: "settings", Namespace: "dev", File: "config.yaml", Action: ActionSkippedCreateOnly},
+		{Kind: "Job", Name: "migrate", Namespace: "dev", File: "job.yaml", Action: "created", Rollout: RolloutTimeout, Error: "Job \"migrate\" rolling update timed out"},
+		{Kind: "Service", Name: "app", Namespace: "dev", File: "app.yaml", Action: ActionNotDeployed},
+	}
+	if !reflect.DeepEqual(report.Resources, want) {
+		t.Errorf("got: %#v\nwant: %#v\n", report.Resources, want)
+	}
+}
+
+func TestDeployReportJUnit(t *testing.T) {
+	report := newDeployReport(time.Now(), reportResources(), errors.New("failed"))
+	data, err := report.JUnit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(data)
+	for _, want := range []string{
+		`<testsuite name="kd" tests="4" failures="2" skipped="1"`,
+		`<testcase classname="app.yaml" name="dev/deployment/app" time="2.500">`,
+		`<skipped message="skipped-create-only"></skipped>`,
+		`<failure message="created">Job &#34;migrate&#34; rolling update timed out</failure>`,
+		`<failure message="not-deployed">not deployed due to an earlier error</failure>`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("expected %s in:\n%s", want, got)
+		}
+	}
+}
+
+func TestWriteReports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kd-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	jsonReport := filepath.Join(dir, "report.json")
+	junitReport := filepath.Join(dir, "report.xml")
+	ctx := newTestContext([]cli.Flag{cli.StringSliceFlag{Name: FlagReport}},
+		[]string{"--" + FlagReport, jsonReport, "--" + FlagReport, junitReport})
+	if err := writeReports(ctx, time.Now(), reportResources()[:2], nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(jsonReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var report DeployReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		t.Fatalf("invalid json report: %s", err)
+	}
+	if !report.Success || len(report.Resources) != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	data, err = ioutil.ReadFile(junitReport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "<?xml") {
+		t.Errorf("expected a JUnit XML report, got:\n%s", data)
+	}
+}
@@ -0,0 +1,95 @@
+//go:build ignore
+// +build ignore
+
+// generate trims a kubernetes api/openapi-spec/swagger.json to the parts used
+// to validate resources and writes it gzipped for embedding e.g.
+//
+//	go run schemas/generate.go swagger.json schemas/kubernetes-1.36.json.gz
+package main
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+// keep are the schema keys used by validation
+var keep = map[string]bool{
+	"$ref":                                 true,
+	"type":                                 true,
+	"format":                               true,
+	"properties":                           true,
+	"items":                                true,
+	"additionalProperties":                 true,
+	"x-kubernetes-group-version-kind":      true,
+	"x-kubernetes-int-or-string":           true,
+	"x-kubernetes-preserve-unknown-fields": true,
+}
+
+func main() {
+	if len(os.Args) != 3 {
+		log.Fatal("usage: generate.go swagger.json output.json.gz")
+	}
+	data, err := ioutil.ReadFile(os.Args[1])
+	if err != nil {
+		log.Fatal(err)
+	}
+	var spec struct {
+		Definitions map[string]interface{} `json:"definitions"`
+	}
+	if err := json.Unmarshal(data, &spec); err != nil {
+		log.Fatal(err)
+	}
+	for name, def := range spec.Definitions {
+		spec.Definitions[name] = trim(def)
+	}
+	f, err := os.Create(os.Args[2])
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	w, _ := gzip.NewWriterLevel(f, gzip.BestCompression)
+	if err := json.NewEncoder(w).Encode(spec); err != nil {
+		log.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// trim removes the keys not used by validation from a schema
+func trim(v interface{}) interface{} {
+	schema, ok := v.(map[string]interface{})
+	if !ok {
+		return v
+	}
+	trimmed := map[string]interface{}{}
+	for k, value := range schema {
+		if !keep[k] {
+			continue
+		}
+		switch k {
+		case "properties":
+			props := map[string]interface{}{}
+			for name, prop := range value.(map[string]interface{}) {
+				props[name] = trim(prop)
+			}
+			trimmed[k] = props
+		case "items":
+			trimmed[k] = trim(value)
+		case "additionalProperties":
+			if b, isBool := value.(bool); isBool {
+				if b {
+					trimmed[k] = map[string]interface{}{}
+				}
+				continue
+			}
+			trimmed[k] = trim(value)
+		default:
+			trimmed[k] = value
+		}
+	}
+	return trimmed
+}
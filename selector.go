@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// selectorOperator is the comparison made by a label selector requirement
+type selectorOperator string
+
+const (
+	selectorEquals       selectorOperator = "="
+	selectorNotEquals    selectorOperator = "!="
+	selectorIn           selectorOperator = "in"
+	selectorNotIn        selectorOperator = "notin"
+	selectorExists       selectorOperator = "exists"
+	selectorDoesNotExist selectorOperator = "!"
+)
+
+var (
+	// selectorSetRequirement matches e.g. "tier in (web, api)"
+	selectorSetRequirement = regexp.MustCompile(`^([^\s!=(),]+)\s+(in|notin)\s+\(([^()]*)\)$`)
+	// selectorValueRequirement matches e.g. "app=foo", "app==foo" or "tier!=db"
+	selectorValueRequirement = regexp.MustCompile(`^([^\s!=(),]+)\s*(==|=|!=)\s*([^\s!=(),]*)$`)
+	// selectorKey matches a label key on its own
+	selectorKey = regexp.MustCompile(`^[^\s!=(),]+$`)
+)
+
+// selectorRequirement is a single requirement of a label selector
+type selectorRequirement struct {
+	Key      string
+	Operator selectorOperator
+	Values   []string
+}
+
+// LabelSelector is a parsed kubernetes label selector e.g. "app=foo,tier!=db"
+type LabelSelector []selectorRequirement
+
+// ParseLabelSelector parses the kubernetes label selector syntax supporting
+// equality (=, ==, !=), set (in, notin) and existence (key, !key) requirements
+func ParseLabelSelector(s string) (LabelSelector, error) {
+	var selector LabelSelector
+	for _, part := range splitSelector(s) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if m := selectorSetRequirement.FindStringSubmatch(part); m != nil {
+			var values []string
+			for _, v := range strings.Split(m[3], ",") {
+				if v = strings.TrimSpace(v); v != "" {
+					values = append(values, v)
+				}
+			}
+			selector = append(selector, selectorRequirement{
+				Key:      m[1],
+				Operator: selectorOperator(m[2]),
+				Values:   values,
+			})
+			continue
+		}
+		if m := selectorValueRequirement.FindStringSubmatch(part); m != nil {
+			op := selectorEquals
+			if m[2] == "!=" {
+				op = selectorNotEquals
+			}
+			selector = append(selector, selectorRequirement{
+				Key:      m[1],
+				Operator: op,
+				Values:   []string{m[3]},
+			})
+			continue
+		}
+		if strings.HasPrefix(part, "!") && selectorKey.MatchString(strings.TrimSpace(part[1:])) {
+			selector = append(selector, selectorRequirement{
+				Key:      strings.TrimSpace(part[1:]),
+				Operator: selectorDoesNotExist,
+			})
+			continue
+		}
+		if selectorKey.MatchString(part) {
+			selector = append(selector, selectorRequirement{
+				Key:      part,
+				Operator: selectorExists,
+			})
+			continue
+		}
+		return nil, fmt.Errorf("invalid label selector requirement %q in %q", part, s)
+	}
+	return selector, nil
+}
+
+// splitSelector splits a selector on commas outside of any parentheses
+func splitSelector(s string) []string {
+	var parts []string
+	depth := 0
+	start := 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Matches reports if a set of labels satisfies all the selector requirements
+func (s LabelSelector) Matches(labels map[string]string) bool {
+	for _, req := range s {
+		value, found := labels[req.Key]
+		switch req.Operator {
+		case selectorEquals:
+			if !found || value != req.Values[0] {
+				return false
+			}
+		case selectorNotEquals:
+			if found && value == req.Values[0] {
+				return false
+			}
+		case selectorIn:
+			if !found || !containsString(req.Values, value) {
+				return false
+			}
+		case selectorNotIn:
+			if found && containsString(req.Values, value) {
+				return false
+			}
+		case selectorExists:
+			if !found {
+				return false
+			}
+		case selectorDoesNotExist:
+			if found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// containsString reports if a list contains a string
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	labels := map[string]string{"app": "foo", "tier": "web"}
+	cases := []struct {
+		name     string
+		selector string
+		want     bool
+	}{
+		{name: "Check empty selector matches", selector: "", want: true},
+		{name: "Check equality", selector: "app=foo", want: true},
+		{name: "Check double equality", selector: "app==bar", want: false},
+		{name: "Check inequality", selector: "app=foo,tier!=db", want: true},
+		{name: "Check inequality does not match", selector: "tier!=web", want: false},
+		{name: "Check in", selector: "tier in (web, api),app", want: true},
+		{name: "Check notin", selector: "tier notin (web)", want: false},
+		{name: "Check exists", selector: "team", want: false},
+		{name: "Check does not exist", selector: "!team", want: true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s, err := ParseLabelSelector(c.selector)
+			if err != nil {
+				t.Fatalf("unexpected error parsing %q: %s", c.selector, err)
+			}
+			if got := s.Matches(labels); got != c.want {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+
+	if _, err := ParseLabelSelector("app=(foo"); err == nil {
+		t.Errorf("expected an error parsing an invalid selector")
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cavaliercoder/grab"
+	"github.com/urfave/cli"
+)
+
+// StdinFile is the file name used to read resources from stdin
+const StdinFile = "-"
+
+var (
+	// stdinData caches stdin so it can be read more than once
+	stdinData []byte
+	stdinRead bool
+
+	// remoteFiles caches downloaded remote files by source
+	remoteFiles = map[string]string{}
+
+	// checksumHashes are the supported checksum algorithms for remote files
+	checksumHashes = map[string]func() hash.Hash{
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+	}
+)
+
+// isRemoteFile reports if a file is a http(s) URL
+func isRemoteFile(fn string) bool {
+	return strings.HasPrefix(fn, "https://") || strings.HasPrefix(fn, "http://")
+}
+
+// readResourceFile reads a local file, stdin (-) or a remote http(s) file
+func readResourceFile(fn string) ([]byte, error) {
+	switch {
+	case fn == StdinFile:
+		if !stdinRead {
+			var err error
+			if stdinData, err = ioutil.ReadAll(os.Stdin); err != nil {
+				return nil, fmt.Errorf("error reading resources from stdin:%s", err)
+			}
+			stdinRead = true
+		}
+		return stdinData, nil
+	case isRemoteFile(fn):
+		local, err := downloadRemoteFile(fn)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.ReadFile(local)
+	}
+	return ioutil.ReadFile(fn)
+}
+
+// downloadRemoteFile downloads a remote file to the kd temp dir, verifying
+// any checksum specified as a URL fragment e.g. https://host/app.yaml#sha256=...
+func downloadRemoteFile(source string) (string, error) {
+	if local, found := remoteFiles[source]; found {
+		return local, nil
+	}
+	uri, err := url.Parse(source)
+	if err != nil {
+		return "", fmt.Errorf("invalid remote file %s:%s", redact(source), err)
+	}
+	fragment := uri.Fragment
+	uri.Fragment = ""
+	safe := redactURL(uri)
+
+	dir, err := ioutil.TempDir(getKdTempDir(), "remote")
+	if err != nil {
+		return "", err
+	}
+	// URLs without a file name (e.g. https://host/) are saved as resources.yaml
+	name := path.Base(uri.Path)
+	if name == "/" || name == "." {
+		name = "resources.yaml"
+	}
+	req, err := grab.NewRequest(filepath.Join(dir, name), uri.String())
+	if err != nil {
+		return "", fmt.Errorf("problem downloading %s:%s", safe, redactURLError(err, uri))
+	}
+	if fragment != "" {
+		h, sum, err := parseChecksum(fragment)
+		if err != nil {
+			return "", fmt.Errorf("invalid checksum for %s:%s", safe, err)
+		}
+		req.SetChecksum(h, sum, true)
+	}
+	logDebug.Printf("downloading %s to %s", safe, dir)
+	resp := grab.NewClient().Do(req)
+	if err := resp.Err(); err != nil {
+		if err == grab.ErrBadChecksum {
+			return "", fmt.Errorf("checksum mismatch for %s, expected %s", safe, fragment)
+		}
+		return "", fmt.Errorf("problem downloading %s:%s", safe, redactURLError(err, uri))
+	}
+	logInfo.Printf("downloaded resources from %s", safe)
+	remoteFiles[source] = resp.Filename
+	return resp.Filename, nil
+}
+
+// redactURL masks any credentials and query values (e.g. tokens) in a URL
+func redactURL(uri *url.URL) string {
+	masked := *uri
+	if masked.User != nil {
+		masked.User = url.User(RedactedValue)
+	}
+	if masked.RawQuery != "" {
+		var params []string
+		for k := range masked.Query() {
+			params = append(params, k+"="+RedactedValue)
+		}
+		sort.Strings(params)
+		masked.RawQuery = strings.Join(params, "&")
+	}
+	return redact(masked.String())
+}
+
+// redactURLError masks a URL and any sensitive values in an error
+func redactURLError(err error, uri *url.URL) string {
+	return redact(strings.Replace(err.Error(), uri.String(), redactURL(uri), -1))
+}
+
+// parseChecksum parses a checksum of the form algorithm=hex e.g. sha256=abc...
+func parseChecksum(s string) (hash.Hash, []byte, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return nil, nil, errors.New("expecting sha256=<hex> or sha512=<hex>")
+	}
+	newHash, ok := checksumHashes[strings.ToLower(parts[0])]
+	if !ok {
+		return nil, nil, fmt.Errorf("unsupported checksum algorithm %s", parts[0])
+	}
+	sum, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return newHash(), sum, nil
+}
+
+// hasChecksum reports if a remote file is pinned with a checksum
+func hasChecksum(source string) bool {
+	uri, err := url.Parse(source)
+	return err == nil && uri.Fragment != ""
+}
+
+// hasResourceSources reports if any files, kustomizations or a chart are specified
+func hasResourceSources(c *cli.Context) bool {
+	return len(c.StringSlice("file")) > 0 || len(c.StringSlice(FlagKustomize)) > 0 ||
+		c.String(FlagChart) != ""
+}
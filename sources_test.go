@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadResourceFileRemote(t *testing.T) {
+	content := []byte("kind: ConfigMap\nmetadata:\n  name: remote\n")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	defer server.Close()
+	defer cleanup()
+
+	sum := sha256.Sum256(content)
+	cases := []struct {
+		name    string
+		input   string
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name:  "Check remote file is downloaded",
+			input: server.URL + "/app.yaml",
+			want:  content,
+		},
+		{
+			name:  "Check remote file with a matching checksum is downloaded",
+			input: fmt.Sprintf("%s/pinned.yaml#sha256=%s", server.URL, hex.EncodeToString(sum[:])),
+			want:  content,
+		},
+		{
+			name:  "Check remote file without a file name is downloaded",
+			input: server.URL + "/",
+			want:  content,
+		},
+		{
+			name:    "Check remote file with a different checksum is an error",
+			input:   server.URL + "/bad.yaml#sha256=" + hex.EncodeToString(make([]byte, 32)),
+			wantErr: true,
+		},
+		{
+			name:    "Check unsupported checksum algorithm is an error",
+			input:   server.URL + "/md5.yaml#md5=00",
+			wantErr: true,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := readResourceFile(c.input)
+			if c.wantErr {
+				if err == nil {
+					t.Errorf("expected an error reading %s", c.input)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", string(got), string(c.want))
+			}
+		})
+	}
+}
+
+func TestReadResourceFileRemoteErrorsAreRedacted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer cleanup()
+	missing := server.URL + "/missing.yaml?token=s3cr3tt0ken"
+	server.Close()
+
+	_, err := readResourceFile(missing)
+	if err == nil {
+		t.Fatal("expected an error downloading from a closed server")
+	}
+	if strings.Contains(err.Error(), "s3cr3tt0ken") {
+		t.Errorf("expected the token to be masked, got: %s", err)
+	}
+	if !strings.Contains(err.Error(), "token=***") {
+		t.Errorf("expected the masked url in the error, got: %s", err)
+	}
+}
+
+func TestReadResourceFileStdin(t *testing.T) {
+	content := "kind: ConfigMap\nmetadata:\n  name: stdin\n"
+	f, err := ioutil.TempFile("", "kd-stdin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = f
+	defer func() {
+		os.Stdin = stdin
+		stdinData, stdinRead = nil, false
+	}()
+
+	// Stdin can only be read once so is cached for later reads
+	for i := 0; i < 2; i++ {
+		got, err := readResourceFile(StdinFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != content {
+			t.Errorf("read %d got: %q\nwant: %q\n", i, got, content)
+		}
+	}
+}
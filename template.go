@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// FlagOutputDir is the template command flag to write one file per resource
+const FlagOutputDir = "output-dir"
+
+// templateResources is the template command action, it renders all the
+// resources as run does but writes them out instead of deploying them
+func templateResources(c *cli.Context) error {
+	parent := c.Parent()
+	if err := setupLogging(parent); err != nil {
+		return err
+	}
+	setupRedaction(parent)
+	// Keep stdout for the resources only
+	logInfo.SetOutput(newLogWriter(os.Stderr, LogLevelInfo))
+
+	if !hasResourceSources(parent) {
+		return errors.New("no kubernetes resource files, kustomizations or chart specified")
+	}
+	conf, err := GetAnyConfigData(parent)
+	if err != nil {
+		return err
+	}
+	files, err := listFiles(parent)
+	if err != nil {
+		return err
+	}
+	if parent.IsSet(FlagAllowMissing) {
+		allowMissingVariables = true
+	}
+	resources, err := renderResources(parent, conf, files)
+	if err != nil {
+		return err
+	}
+	if c.String(FlagOutputDir) != "" {
+		return writeResourceFiles(c.String(FlagOutputDir), resources)
+	}
+	return writeResources(os.Stdout, resources)
+}
+
+// writeResources writes resources as a multi-document yaml stream
+func writeResources(w io.Writer, resources []*ObjectResource) error {
+	for _, r := range resources {
+		if _, err := fmt.Fprintf(w, "---\n%s", withTrailingNewline(r.Template)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeResourceFiles writes each resource to a file named kind-name.yaml
+func writeResourceFiles(dir string, resources []*ObjectResource) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	written := map[string]string{}
+	for _, r := range resources {
+		fn := resourceFileName(r)
+		if from, found := written[fn]; found {
+			return fmt.Errorf(
+				"resources from %s and %s would both be written to %s",
+				from, r.FileName, fn)
+		}
+		written[fn] = r.FileName
+		path := filepath.Join(dir, fn)
+		if err := ioutil.WriteFile(path, withTrailingNewline(r.Template), 0644); err != nil {
+			return err
+		}
+		logInfo.Printf("wrote %s/%s to %s", strings.ToLower(r.Kind), r.Name, path)
+	}
+	return nil
+}
+
+// resourceFileName is the file name for a resource e.g. deployment-nginx.yaml
+func resourceFileName(r *ObjectResource) string {
+	name := r.Name
+	if name == "" {
+		name = strings.TrimSuffix(r.GenerateName, "-")
+	}
+	parts := []string{}
+	for _, p := range []string{strings.ToLower(r.Kind), name} {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	if len(parts) == 0 {
+		parts = []string{"resource"}
+	}
+	return strings.Join(parts, "-") + ".yaml"
+}
+
+// withTrailingNewline ensures a document ends with a newline
+func withTrailingNewline(b []byte) []byte {
+	if len(b) > 0 && !bytes.HasSuffix(b, []byte("\n")) {
+		return append(b, '\n')
+	}
+	return b
+}
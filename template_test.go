@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteResources(t *testing.T) {
+	resources := []*ObjectResource{
+		{Kind: "ConfigMap", ObjectMeta: ObjectMeta{Name: "a"}, Template: []byte("kind: ConfigMap\nmetadata:\n  name: a\n")},
+		{Kind: "Job", ObjectMeta: ObjectMeta{GenerateName: "migrate-"}, Template: []byte("kind: Job\nmetadata:\n  generateName: migrate-")},
+	}
+
+	var b bytes.Buffer
+	if err := writeResources(&b, resources); err != nil {
+		t.Fatal(err)
+	}
+	want := "---\nkind: ConfigMap\nmetadata:\n  name: a\n---\nkind: Job\nmetadata:\n  generateName: migrate-\n"
+	if got := b.String(); got != want {
+		t.Errorf("got: %#v\nwant: %#v\n", got, want)
+	}
+
+	dir, err := ioutil.TempDir("", "kd-template")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := writeResourceFiles(dir, resources); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	wantFiles := []string{filepath.Join(dir, "configmap-a.yaml"), filepath.Join(dir, "job-migrate.yaml")}
+	if !reflect.DeepEqual(got, wantFiles) {
+		t.Errorf("got: %#v\nwant: %#v\n", got, wantFiles)
+	}
+
+	if err := writeResourceFiles(dir, append(resources, resources[0])); err == nil {
+		t.Errorf("expected an error writing two resources to the same file")
+	}
+}
@@ -2,13 +2,17 @@ package main
 
 // ObjectResource is minimal kubernetes resource representation
 type ObjectResource struct {
+	APIVersion       string `yaml:"apiVersion"`
 	Kind             string `yaml:"kind"`
 	ObjectMeta       `yaml:"metadata,omitempty"`
 	Template         []byte `yaml:"-"`
 	FileName         string `yaml:"-"`
 	DeploymentStatus `yaml:"status,omitempty"`
 	ObjectSpec       `yaml:"spec"`
-	CreateOnly       bool `yaml:"-"`
+	CreateOnly       bool           `yaml:"-"`
+	Result           ResourceResult `yaml:"-"`
+	// live is the deployed object, fetched once to record Events about it
+	live map[string]interface{}
 }
 
 // ObjectMeta is a resource metadata that all persisted resources must have
@@ -27,6 +31,12 @@ type ObjectMeta struct {
 
 	// GenerateName causes kubernetes to generate a random resource name for you on create, it takes the given string and suffixes a random string to it
 	GenerateName string `yaml:"generateName,omitempty"`
+
+	// Labels are key value pairs used to organize and select resources
+	Labels map[string]string `yaml:"labels,omitempty"`
+
+	// Annotations are key value pairs used to store arbitrary non-identifying metadata
+	Annotations map[string]string `yaml:"annotations,omitempty"`
 }
 
 // DeploymentStatus is the most recently observed status of the Deployment / Statefulset / DaemonSets.
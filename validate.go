@@ -0,0 +1,446 @@
+package main
+
+//go:generate sh -c "for v in 1.34.4 1.35.4 1.36.3; do go run schemas/generate.go swagger-$v.json schemas/kubernetes-${v%.*}.json.gz; done"
+
+import (
+	"compress/gzip"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+	yaml "gopkg.in/yaml.v2"
+)
+
+const (
+	// FlagValidate validates the rendered resources against kubernetes schemas
+	FlagValidate = "validate"
+	// FlagSchema adds CRD schemas used to validate custom resources
+	FlagSchema = "schema"
+
+	// objectMetaRef is the schema for the metadata of all resources
+	objectMetaRef = "#/definitions/io.k8s.apimachinery.pkg.apis.meta.v1.ObjectMeta"
+	// quantitySuffix identifies a resource quantity schema e.g. cpu: 100m or cpu: 1
+	quantitySuffix = ".api.resource.Quantity"
+)
+
+// bundledSchemas are the trimmed kubernetes OpenAPI definitions by version,
+// see schemas/generate.go
+//
+//go:embed schemas/*.json.gz
+var bundledSchemas embed.FS
+
+// schema is the subset of an OpenAPI schema used to validate resources
+type schema struct {
+	Ref                   string             `json:"$ref,omitempty"`
+	Type                  string             `json:"type,omitempty"`
+	Format                string             `json:"format,omitempty"`
+	Properties            map[string]*schema `json:"properties,omitempty"`
+	Items                 *schema            `json:"items,omitempty"`
+	AdditionalProperties  *schema            `json:"additionalProperties,omitempty"`
+	GroupVersionKinds     []groupVersionKind `json:"x-kubernetes-group-version-kind,omitempty"`
+	IntOrString           bool               `json:"x-kubernetes-int-or-string,omitempty"`
+	PreserveUnknownFields bool               `json:"x-kubernetes-preserve-unknown-fields,omitempty"`
+}
+
+// groupVersionKind identifies the schema for a kind of resource
+type groupVersionKind struct {
+	Group   string `json:"group"`
+	Version string `json:"version"`
+	Kind    string `json:"kind"`
+}
+
+// schemaValidator checks resources against the schemas for their kinds
+type schemaValidator struct {
+	definitions map[string]*schema
+	kinds       map[groupVersionKind]*schema
+}
+
+// newSchemaValidator loads the bundled schemas for a kubernetes version e.g.
+// 1.35 or v1.35.2, the latest bundled version is used if not specified
+func newSchemaValidator(version string) (*schemaValidator, error) {
+	versions := bundledSchemaVersions()
+	if version == "" {
+		version = versions[len(versions)-1]
+	}
+	version = schemaVersion(version)
+	f, err := bundledSchemas.Open("schemas/kubernetes-" + version + ".json.gz")
+	if err != nil {
+		return nil, fmt.Errorf(
+			"no schemas bundled for kubernetes version %s, expecting one of %s",
+			version, strings.Join(versions, ", "))
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	var spec struct {
+		Definitions map[string]*schema `json:"definitions"`
+	}
+	if err := json.NewDecoder(r).Decode(&spec); err != nil {
+		return nil, fmt.Errorf("error loading schemas for kubernetes %s:%s", version, err)
+	}
+	v := &schemaValidator{
+		definitions: spec.Definitions,
+		kinds:       map[groupVersionKind]*schema{},
+	}
+	for _, def := range spec.Definitions {
+		for _, gvk := range def.GroupVersionKinds {
+			v.kinds[gvk] = def
+		}
+	}
+	logDebug.Printf("loaded schemas for kubernetes %s", version)
+	return v, nil
+}
+
+// bundledSchemaVersions lists the bundled kubernetes versions, oldest first
+func bundledSchemaVersions() []string {
+	entries, _ := bundledSchemas.ReadDir("schemas")
+	var versions []string
+	for _, e := range entries {
+		versions = append(versions, strings.TrimSuffix(strings.TrimPrefix(e.Name(), "kubernetes-"), ".json.gz"))
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return minorVersion(versions[i]) < minorVersion(versions[j])
+	})
+	return versions
+}
+
+// schemaVersion gets the major.minor version from a kubernetes version
+func schemaVersion(version string) string {
+	parts := strings.SplitN(strings.TrimPrefix(version, "v"), ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// minorVersion gets the minor number of a 1.x version for ordering
+func minorVersion(version string) int {
+	parts := strings.Split(version, ".")
+	minor, _ := strconv.Atoi(parts[len(parts)-1])
+	return minor
+}
+
+// addCRD adds the schemas from a CustomResourceDefinition, any other objects
+// are ignored
+func (v *schemaValidator) addCRD(obj map[string]interface{}) error {
+	if obj["kind"] != "CustomResourceDefinition" {
+		return nil
+	}
+	spec, _ := toStringMap(obj["spec"])
+	names, _ := toStringMap(spec["names"])
+	group, _ := spec["group"].(string)
+	kind, _ := names["kind"].(string)
+	// apiextensions.k8s.io/v1beta1 may have a schema for all versions
+	validation, _ := toStringMap(spec["validation"])
+	shared := validation["openAPIV3Schema"]
+	versions, _ := spec["versions"].([]interface{})
+	if version, ok := spec["version"].(string); ok && len(versions) == 0 {
+		versions = []interface{}{map[interface{}]interface{}{"name": version}}
+	}
+	for _, item := range versions {
+		version, _ := toStringMap(item)
+		name, _ := version["name"].(string)
+		versionSchema, _ := toStringMap(version["schema"])
+		raw := versionSchema["openAPIV3Schema"]
+		if raw == nil {
+			raw = shared
+		}
+		if raw == nil {
+			continue
+		}
+		s, err := parseSchema(raw)
+		if err != nil {
+			return fmt.Errorf("invalid schema for %s/%s %s:%s", group, name, kind, err)
+		}
+		if s.Properties == nil {
+			s.Properties = map[string]*schema{}
+		}
+		s.Properties["apiVersion"] = &schema{Type: "string"}
+		s.Properties["kind"] = &schema{Type: "string"}
+		s.Properties["metadata"] = &schema{Ref: objectMetaRef}
+		v.kinds[groupVersionKind{Group: group, Version: name, Kind: kind}] = s
+		logDebug.Printf("added schema for %s/%s %s", group, name, kind)
+	}
+	return nil
+}
+
+// parseSchema converts an openAPIV3Schema from yaml to a schema
+func parseSchema(raw interface{}) (*schema, error) {
+	b, err := json.Marshal(normalizeSchema(normalizeValue(raw)))
+	if err != nil {
+		return nil, err
+	}
+	s := &schema{}
+	return s, json.Unmarshal(b, s)
+}
+
+// normalizeSchema converts additionalProperties: true to an empty (any value)
+// schema and drops additionalProperties: false
+func normalizeSchema(v interface{}) interface{} {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		for k, nested := range value {
+			if b, isBool := nested.(bool); isBool && k == "additionalProperties" {
+				if b {
+					value[k] = map[string]interface{}{}
+				} else {
+					delete(value, k)
+				}
+				continue
+			}
+			value[k] = normalizeSchema(nested)
+		}
+	case []interface{}:
+		for i, nested := range value {
+			value[i] = normalizeSchema(nested)
+		}
+	}
+	return v
+}
+
+// Validate checks a rendered resource against the schema for its kind
+func (v *schemaValidator) Validate(r *ObjectResource) []LintFinding {
+	var doc interface{}
+	if err := yaml.Unmarshal(r.Template, &doc); err != nil {
+		return []LintFinding{v.finding(r, LintSeverityError, "yaml-syntax", err.Error())}
+	}
+	obj, ok := toStringMap(doc)
+	if !ok || r.Kind == "" {
+		return nil
+	}
+	apiVersion, _ := obj["apiVersion"].(string)
+	gvk := groupVersionKind{Version: apiVersion, Kind: r.Kind}
+	if parts := strings.SplitN(apiVersion, "/", 2); len(parts) == 2 {
+		gvk.Group, gvk.Version = parts[0], parts[1]
+	}
+	s, found := v.kinds[gvk]
+	if !found {
+		return []LintFinding{v.finding(r, LintSeverityWarning, "missing-schema",
+			fmt.Sprintf("no schema for %s %s, use --%s to add CRD schemas", apiVersion, r.Kind, FlagSchema))}
+	}
+	var findings []LintFinding
+	for _, problem := range v.validate("", obj, s) {
+		findings = append(findings, v.finding(r, LintSeverityError, problem.rule, problem.message))
+	}
+	return findings
+}
+
+// finding creates a finding for a resource
+func (v *schemaValidator) finding(r *ObjectResource, severity, rule, message string) LintFinding {
+	return LintFinding{
+		File:     r.FileName,
+		Severity: severity,
+		Rule:     rule,
+		Message:  fmt.Sprintf("%s/%s: %s", strings.ToLower(r.Kind), r.Name, message),
+	}
+}
+
+// schemaProblem is a field which doesn't match the schema
+type schemaProblem struct {
+	rule    string
+	message string
+}
+
+// validate checks a value and anything it contains against a schema
+func (v *schemaValidator) validate(path string, value interface{}, s *schema) []schemaProblem {
+	if value == nil || s == nil {
+		return nil
+	}
+	if s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/definitions/")
+		if strings.HasSuffix(name, quantitySuffix) {
+			return v.expect(path, value, "quantity", isString(value) || isNumber(value))
+		}
+		return v.validate(path, value, v.definitions[name])
+	}
+	if s.IntOrString || s.Format == "int-or-string" {
+		return v.expect(path, value, "integer or string", isString(value) || isInteger(value))
+	}
+	switch s.Type {
+	case "object":
+		m, ok := toStringMap(value)
+		if !ok {
+			return v.expect(path, value, "object", false)
+		}
+		return v.validateObject(path, m, s)
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return v.expect(path, value, "array", false)
+		}
+		var problems []schemaProblem
+		for i, item := range list {
+			problems = append(problems, v.validate(fmt.Sprintf("%s[%d]", path, i), item, s.Items)...)
+		}
+		return problems
+	case "string":
+		_, isTime := value.(time.Time)
+		return v.expect(path, value, "string", isString(value) || isTime)
+	case "integer":
+		return v.expect(path, value, "integer", isInteger(value))
+	case "number":
+		return v.expect(path, value, "number", isNumber(value))
+	case "boolean":
+		_, ok := value.(bool)
+		return v.expect(path, value, "boolean", ok)
+	}
+	return nil
+}
+
+// validateObject checks the fields of an object are known and valid
+func (v *schemaValidator) validateObject(path string, m map[string]interface{}, s *schema) []schemaProblem {
+	// An object without any properties holds any fields e.g. a RawExtension
+	freeForm := s.PreserveUnknownFields || (len(s.Properties) == 0 && s.AdditionalProperties == nil)
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var problems []schemaProblem
+	for _, k := range keys {
+		field := k
+		if path != "" {
+			field = path + "." + k
+		}
+		if prop, ok := s.Properties[k]; ok {
+			problems = append(problems, v.validate(field, m[k], prop)...)
+			continue
+		}
+		if s.AdditionalProperties != nil {
+			problems = append(problems, v.validate(field, m[k], s.AdditionalProperties)...)
+			continue
+		}
+		if !freeForm {
+			problems = append(problems, schemaProblem{
+				rule:    "unknown-field",
+				message: fmt.Sprintf("%s: unknown field", field),
+			})
+		}
+	}
+	return problems
+}
+
+// expect reports a type error unless a value is of the type expected
+func (v *schemaValidator) expect(path string, value interface{}, expected string, ok bool) []schemaProblem {
+	if ok {
+		return nil
+	}
+	return []schemaProblem{{
+		rule:    "invalid-type",
+		message: fmt.Sprintf("%s: expected %s, got %s", path, expected, typeName(value)),
+	}}
+}
+
+// isString reports if a value is a string
+func isString(value interface{}) bool {
+	_, ok := value.(string)
+	return ok
+}
+
+// isInteger reports if a value is an integer
+func isInteger(value interface{}) bool {
+	switch value.(type) {
+	case int, int64, uint64:
+		return true
+	}
+	return false
+}
+
+// isNumber reports if a value is an integer or a float
+func isNumber(value interface{}) bool {
+	_, isFloat := value.(float64)
+	return isFloat || isInteger(value)
+}
+
+// typeName describes the type of a yaml value
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[interface{}]interface{}, map[string]interface{}:
+		return "object"
+	}
+	if isInteger(value) {
+		return "integer"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// loadSchemaFiles adds the CRD schemas from files or directories of files
+func (v *schemaValidator) loadSchemaFiles(paths []string) error {
+	for _, p := range paths {
+		files := []string{p}
+		if stat, err := os.Stat(p); err == nil && stat.IsDir() {
+			if files, err = ListDirectory(p); err != nil {
+				return err
+			}
+		}
+		for _, f := range files {
+			data, err := readResourceFile(f)
+			if err != nil {
+				return err
+			}
+			for _, d := range splitYamlDocs(string(data)) {
+				items, err := splitListItems(d)
+				if err != nil {
+					return err
+				}
+				for _, item := range items {
+					var doc interface{}
+					if err := yaml.Unmarshal([]byte(item), &doc); err != nil {
+						return fmt.Errorf("error parsing schema file '%s':%s", f, err)
+					}
+					obj, _ := toStringMap(doc)
+					if err := v.addCRD(obj); err != nil {
+						return fmt.Errorf("error loading schema file '%s':%s", f, err)
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// validateResources validates all the rendered resources, including custom
+// resources defined by any CRDs being deployed, reporting all the problems
+func validateResources(c *cli.Context, resources []*ObjectResource) error {
+	v, err := newSchemaValidator(c.String(FlagKubeVersion))
+	if err != nil {
+		return err
+	}
+	if err := v.loadSchemaFiles(c.StringSlice(FlagSchema)); err != nil {
+		return err
+	}
+	for _, r := range resources {
+		var doc interface{}
+		if yaml.Unmarshal(r.Template, &doc) == nil {
+			obj, _ := toStringMap(doc)
+			if err := v.addCRD(obj); err != nil {
+				return err
+			}
+		}
+	}
+	var findings []LintFinding
+	for _, r := range resources {
+		findings = append(findings, v.Validate(r)...)
+	}
+	if err := reportFindings("schema validation", findings); err != nil {
+		return err
+	}
+	logInfo.Printf("validated %d resources", len(resources))
+	return nil
+}
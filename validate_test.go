@@ -0,0 +1,145 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+func TestSchemaValidatorValidate(t *testing.T) {
+	cases := []struct {
+		name     string
+		template string
+		want     []string
+	}{
+		{
+			name: "valid deployment",
+			template: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  labels:
+    app: app
+  creationTimestamp: null
+spec:
+  replicas: 2
+  strategy:
+    rollingUpdate:
+      maxSurge: 25%
+      maxUnavailable: 1
+  template:
+    spec:
+      containers:
+      - name: app
+        image: app:v1
+        resources:
+          limits:
+            cpu: 1
+            memory: 128Mi
+`,
+		},
+		{
+			name: "unknown fields and type errors",
+			template: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  revisionHistoryLimit: "2"
+  template:
+    spec:
+      contianers:
+      - name: app
+      containers:
+      - name: app
+        ports:
+        - containerPort: http
+        env:
+        - name: PORT
+          value: 8080
+`,
+			want: []string{
+				"[invalid-type] deployment/app: spec.revisionHistoryLimit: expected integer, got string",
+				"[invalid-type] deployment/app: spec.template.spec.containers[0].env[0].value: expected string, got integer",
+				"[invalid-type] deployment/app: spec.template.spec.containers[0].ports[0].containerPort: expected integer, got string",
+				"[unknown-field] deployment/app: spec.template.spec.contianers: unknown field",
+			},
+		},
+		{
+			name: "core api group",
+			template: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app
+data:
+  enabled: true
+`,
+			want: []string{
+				"[invalid-type] configmap/app: data.enabled: expected string, got boolean",
+			},
+		},
+		{
+			name: "custom resource",
+			template: `apiVersion: example.com/v1
+kind: Certificate
+metadata:
+  name: app
+spec:
+  dnsNames: [app.example.com]
+  renewBefore: 720
+  extra:
+    anything: [1, 2]
+  issuer: letsencrypt
+`,
+			want: []string{
+				"[unknown-field] certificate/app: spec.issuer: unknown field",
+			},
+		},
+		{
+			name: "unknown kind",
+			template: `apiVersion: example.com/v1
+kind: Issuer
+metadata:
+  name: app
+`,
+			want: []string{
+				"[missing-schema] issuer/app: no schema for example.com/v1 Issuer, use --schema to add CRD schemas",
+			},
+		},
+	}
+
+	v, err := newSchemaValidator("1.35")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.loadSchemaFiles([]string{"test/TestValidate/"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := &ObjectResource{Template: []byte(c.template)}
+			if err := yaml.Unmarshal(r.Template, r); err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range v.Validate(r) {
+				got = append(got, "["+f.Rule+"] "+f.Message)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("got: %#v\nwant: %#v\n", got, c.want)
+			}
+		})
+	}
+}
+
+func TestNewSchemaValidatorVersions(t *testing.T) {
+	for _, version := range []string{"", "1.34", "v1.36.2"} {
+		if _, err := newSchemaValidator(version); err != nil {
+			t.Errorf("unexpected error for version %q: %s", version, err)
+		}
+	}
+	if _, err := newSchemaValidator("1.12"); err == nil {
+		t.Error("expected an error for a version without schemas")
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	// FlagWebhook sends notifications of the start, success and failure of a
+	// run to URLs
+	FlagWebhook = "webhook"
+	// FlagWebhookFormat sets the payload format, generic, slack or teams
+	FlagWebhookFormat = "webhook-format"
+	// FlagWebhookEvent limits the events notified to start, success or failure
+	FlagWebhookEvent = "webhook-event"
+	// FlagWebhookTimeout is the timeout of each webhook request
+	FlagWebhookTimeout = "webhook-timeout"
+	// FlagWebhookRetries is the number of times a failed webhook request is retried
+	FlagWebhookRetries = "webhook-retries"
+
+	// WebhookFormatGeneric posts the run and resource report as JSON
+	WebhookFormatGeneric = "generic"
+	// WebhookFormatSlack posts a Slack incoming webhook message
+	WebhookFormatSlack = "slack"
+	// WebhookFormatTeams posts a Microsoft Teams message card
+	WebhookFormatTeams = "teams"
+
+	// WebhookEventStart is notified once the resources are rendered
+	WebhookEventStart = "start"
+	// WebhookEventSuccess is notified when all the resources are deployed
+	WebhookEventSuccess = "success"
+	// WebhookEventFailure is notified when a run fails
+	WebhookEventFailure = "failure"
+)
+
+// webhookRetryDelay is the delay before the first retry, doubling on each retry
+var webhookRetryDelay = time.Second
+
+// WebhookPayload is the generic webhook payload, the report has the
+// resources deployed so far and the error of a failure
+type WebhookPayload struct {
+	Event     string `json:"event"`
+	Operation string `json:"operation"`
+	Namespace string `json:"namespace,omitempty"`
+	Context   string `json:"context,omitempty"`
+	Version   string `json:"version,omitempty"`
+	*DeployReport
+}
+
+// Webhook is a URL notified of deployments
+type Webhook struct {
+	URL     string
+	Format  string
+	Retries int
+	client  *http.Client
+}
+
+// newWebhooks creates the webhooks from the global flags
+func newWebhooks(c *cli.Context) ([]*Webhook, error) {
+	format := c.String(FlagWebhookFormat)
+	if format == "" {
+		format = WebhookFormatGeneric
+	}
+	if format != WebhookFormatGeneric && format != WebhookFormatSlack && format != WebhookFormatTeams {
+		return nil, fmt.Errorf("invalid webhook format %s, expecting %s, %s or %s",
+			format, WebhookFormatGeneric, WebhookFormatSlack, WebhookFormatTeams)
+	}
+	for _, event := range c.StringSlice(FlagWebhookEvent) {
+		if event != WebhookEventStart && event != WebhookEventSuccess && event != WebhookEventFailure {
+			return nil, fmt.Errorf("invalid webhook event %s, expecting %s, %s or %s",
+				event, WebhookEventStart, WebhookEventSuccess, WebhookEventFailure)
+		}
+	}
+	client := &http.Client{Timeout: c.Duration(FlagWebhookTimeout)}
+	var webhooks []*Webhook
+	for _, url := range c.StringSlice(FlagWebhook) {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return nil, fmt.Errorf("invalid webhook url %s, expecting http or https", url)
+		}
+		webhooks = append(webhooks, &Webhook{
+			URL:     url,
+			Format:  format,
+			Retries: c.Int(FlagWebhookRetries),
+			client:  client,
+		})
+	}
+	return webhooks, nil
+}
+
+// notifyWebhooks sends an event to all the webhooks, failing to notify is
+// logged as an error but doesn't fail the run
+func notifyWebhooks(c *cli.Context, event string, started time.Time, resources []*ObjectResource, runErr error) {
+	if len(c.StringSlice(FlagWebhook)) == 0 {
+		return
+	}
+	if events := c.StringSlice(FlagWebhookEvent); len(events) > 0 && !containsString(events, event) {
+		return
+	}
+	if dryRun {
+		logDebug.Printf("not sending %s webhook notifications in a dry run", event)
+		return
+	}
+	webhooks, err := newWebhooks(c)
+	if err != nil {
+		logError.Print(err)
+		return
+	}
+	operation := "deploy"
+	if c.Bool(FlagDelete) {
+		operation = "delete"
+	}
+	payload := &WebhookPayload{
+		Event:        event,
+		Operation:    operation,
+		Namespace:    c.String("namespace"),
+		Context:      c.String("context"),
+		Version:      Version,
+		DeployReport: newDeployReport(started, resources, runErr),
+	}
+	if event == WebhookEventStart {
+		payload.Success = false
+		for i := range payload.Resources {
+			payload.Resources[i].Action = ActionPending
+		}
+	}
+	for _, w := range webhooks {
+		if err := w.Send(payload); err != nil {
+			logError.Printf("error sending %s webhook notification:%s", event, err)
+		}
+	}
+}
+
+// Send posts a payload to the webhook, retrying server errors and failed
+// requests with a backoff
+func (w *Webhook) Send(payload *WebhookPayload) error {
+	body, err := webhookBody(w.Format, payload)
+	if err != nil {
+		return err
+	}
+	delay := webhookRetryDelay
+	for attempt := 0; ; attempt++ {
+		retry, err := w.post(body)
+		if err == nil {
+			logDebug.Printf("sent %s webhook notification", payload.Event)
+			return nil
+		}
+		if !retry || attempt >= w.Retries {
+			return err
+		}
+		logDebug.Printf("retrying %s webhook notification in %s:%s", payload.Event, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// post makes a single webhook request, reporting if a failure can be retried
+func (w *Webhook) post(body []byte) (bool, error) {
+	resp, err := w.client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return retry, fmt.Errorf("webhook returned %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return false, nil
+}
+
+// webhookBody encodes a payload in a webhook format
+func webhookBody(format string, p *WebhookPayload) ([]byte, error) {
+	title, text := webhookMessage(p)
+	switch format {
+	case WebhookFormatSlack:
+		return json.Marshal(map[string]string{
+			"text": fmt.Sprintf("*%s*\n%s", title, text),
+		})
+	case WebhookFormatTeams:
+		color := "2EB886"
+		if p.Event == WebhookEventFailure {
+			color = "D00000"
+		} else if p.Event == WebhookEventStart {
+			color = "439FE0"
+		}
+		return json.Marshal(map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"themeColor": color,
+			"summary":    title,
+			"title":      title,
+			// Teams cards need two trailing spaces for a line break
+			"text": strings.Replace(text, "\n", "  \n", -1),
+		})
+	default:
+		return json.Marshal(p)
+	}
+}
+
+// webhookMessage summarises a payload as a title and a line per resource for
+// chat formats
+func webhookMessage(p *WebhookPayload) (string, string) {
+	target := fmt.Sprintf("%d resources", len(p.Resources))
+	if p.Namespace != "" {
+		target += " to namespace " + p.Namespace
+	}
+	if p.Context != "" {
+		target += " (context " + p.Context + ")"
+	}
+	var title string
+	switch p.Event {
+	case WebhookEventStart:
+		title = fmt.Sprintf("kd %s started: %s", p.Operation, target)
+	case WebhookEventSuccess:
+		title = fmt.Sprintf("kd %s succeeded: %s", p.Operation, target)
+	default:
+		title = fmt.Sprintf("kd %s failed: %s", p.Operation, target)
+	}
+	var lines []string
+	for _, r := range p.Resources {
+		line := fmt.Sprintf("%s/%s", strings.ToLower(r.Kind), r.Name)
+		if p.Event != WebhookEventStart {
+			line += " " + r.Action
+			if r.Rollout != "" {
+				line += fmt.Sprintf(" (rollout %s", r.Rollout)
+				if r.TimeToReady > 0 {
+					line += fmt.Sprintf(" in %.1fs", r.TimeToReady)
+				}
+				line += ")"
+			}
+		}
+		lines = append(lines, line)
+	}
+	if p.Error != "" {
+		lines = append(lines, "error: "+p.Error)
+	}
+	return title, strings.Join(lines, "\n")
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// webhookFlags are the global flags used by the webhooks
+func webhookFlags() []cli.Flag {
+	return []cli.Flag{
+		cli.StringSliceFlag{Name: FlagWebhook},
+		cli.StringFlag{Name: FlagWebhookFormat},
+		cli.StringSliceFlag{Name: FlagWebhookEvent},
+		cli.DurationFlag{Name: FlagWebhookTimeout, Value: time.Second},
+		cli.IntFlag{Name: FlagWebhookRetries, Value: 2},
+		cli.StringFlag{Name: "namespace"},
+		cli.StringFlag{Name: "context"},
+		cli.BoolFlag{Name: FlagDelete},
+	}
+}
+
+func TestNotifyWebhooks(t *testing.T) {
+	defer func(d time.Duration) { webhookRetryDelay = d }(webhookRetryDelay)
+	webhookRetryDelay = time.Millisecond
+
+	cases := []struct {
+		name     string
+		format   string
+		event    string
+		events   []string
+		statuses []int
+		err      error
+		requests int32
+		want     []string
+	}{
+		{
+			name:     "Check the generic payload has the report",
+			event:    WebhookEventSuccess,
+			statuses: []int{http.StatusOK},
+			requests: 1,
+			want:     []string{`"event":"success"`, `"operation":"deploy"`, `"namespace":"dev"`, `"success":true`, `"action":"configured"`, `"timeToReady":2.5`},
+		},
+		{
+			name:     "Check the start payload has pending resources",
+			event:    WebhookEventStart,
+			statuses: []int{http.StatusOK},
+			requests: 1,
+			want:     []string{`"event":"start"`, `"success":false`, `"action":"pending"`},
+		},
+		{
+			name:     "Check the failure payload has the error",
+			format:   WebhookFormatSlack,
+			event:    WebhookEventFailure,
+			statuses: []int{http.StatusOK},
+			err:      errors.New("rollout timed out"),
+			requests: 1,
+			want:     []string{`"text":"*kd deploy failed: 4 resources to namespace dev*`, `deployment/app configured (rollout complete in 2.5s)`, `error: rollout timed out`},
+		},
+		{
+			name:     "Check the teams format is a message card",
+			format:   WebhookFormatTeams,
+			event:    WebhookEventSuccess,
+			statuses: []int{http.StatusOK},
+			requests: 1,
+			want:     []string{`"@type":"MessageCard"`, `"title":"kd deploy succeeded: 4 resources to namespace dev"`},
+		},
+		{
+			name:     "Check server errors are retried",
+			event:    WebhookEventSuccess,
+			statuses: []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusOK},
+			requests: 3,
+		},
+		{
+			name:     "Check retries are limited",
+			event:    WebhookEventSuccess,
+			statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusOK},
+			requests: 3,
+		},
+		{
+			name:     "Check client errors are not retried",
+			event:    WebhookEventSuccess,
+			statuses: []int{http.StatusBadRequest, http.StatusOK},
+			requests: 1,
+		},
+		{
+			name:     "Check events can be limited",
+			event:    WebhookEventStart,
+			events:   []string{WebhookEventFailure},
+			statuses: []int{http.StatusOK},
+			requests: 0,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var requests int32
+			var body string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := atomic.AddInt32(&requests, 1)
+				data, _ := ioutil.ReadAll(r.Body)
+				body = string(data)
+				if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+					t.Errorf("unexpected content type %s", ct)
+				}
+				w.WriteHeader(c.statuses[n-1])
+			}))
+			defer server.Close()
+
+			args := []string{"--" + FlagWebhook, server.URL, "--namespace", "dev"}
+			if c.format != "" {
+				args = append(args, "--"+FlagWebhookFormat, c.format)
+			}
+			for _, e := range c.events {
+				args = append(args, "--"+FlagWebhookEvent, e)
+			}
+			notifyWebhooks(newTestContext(webhookFlags(), args), c.event, time.Now(), reportResources(), c.err)
+
+			if requests != c.requests {
+				t.Errorf("got %d requests, want %d", requests, c.requests)
+			}
+			if c.requests > 0 && !json.Valid([]byte(body)) {
+				t.Errorf("invalid json payload: %s", body)
+			}
+			for _, want := range c.want {
+				if !strings.Contains(body, want) {
+					t.Errorf("expected %s in payload:\n%s", want, body)
+				}
+			}
+		})
+	}
+}
+
+func TestWebhookTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	w := &Webhook{URL: server.URL, Format: WebhookFormatGeneric, client: &http.Client{Timeout: 50 * time.Millisecond}}
+	if err := w.Send(&WebhookPayload{Event: WebhookEventStart, DeployReport: &DeployReport{}}); err == nil {
+		t.Error("expected the request to time out")
+	}
+}
+
+func TestNewWebhooks(t *testing.T) {
+	cases := []struct {
+		name string
+		args []string
+		err  string
+	}{
+		{
+			name: "Check an invalid format is rejected",
+			args: []string{"--" + FlagWebhookFormat, "email"},
+			err:  "invalid webhook format email",
+		},
+		{
+			name: "Check an invalid event is rejected",
+			args: []string{"--" + FlagWebhookEvent, "finish"},
+			err:  "invalid webhook event finish",
+		},
+		{
+			name: "Check an invalid url is rejected",
+			args: []string{"--" + FlagWebhook, "hooks.example.com"},
+			err:  "invalid webhook url hooks.example.com",
+		},
+		{
+			name: "Check valid flags are accepted",
+			args: []string{"--" + FlagWebhook, "https://hooks.example.com", "--" + FlagWebhookFormat, WebhookFormatSlack},
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			_, err := newWebhooks(newTestContext(webhookFlags(), c.args))
+			if c.err == "" && err != nil {
+				t.Errorf("unexpected error: %s", err)
+			}
+			if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+				t.Errorf("got error: %v, want: %s", err, c.err)
+			}
+		})
+	}
+}